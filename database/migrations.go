@@ -11,6 +11,29 @@ func RunMigrations(db *sql.DB) error {
 		createUsersTable,
 		createDataTablesTable,
 		createIndexes,
+		createPipelinesTable,
+		createPipelineRunsTable,
+		createIngestedFilesTable,
+		addValidationColumns,
+		createQuarantinedRowsTable,
+		addSchemaEvolutionColumns,
+		createSchemaVersionsTable,
+		createTableVersionsTable,
+		addTableDescriptionColumn,
+		addSoftDeleteColumns,
+		createSharingTables,
+		createOrganizationTables,
+		addTableSchemaNameColumn,
+		createSessionsTable,
+		createAPIKeysTable,
+		addUserRoleColumns,
+		createOIDCTables,
+		createUserTokensTable,
+		createMFATables,
+		createLoginFailuresTable,
+		addUserDisplayNameColumn,
+		createAuditEventsTable,
+		createRateLimitBucketsTable,
 	}
 
 	for i, migration := range migrations {
@@ -47,4 +70,340 @@ CREATE TABLE IF NOT EXISTS data_tables (
 const createIndexes = `
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_data_tables_user_id ON data_tables(user_id);
-CREATE INDEX IF NOT EXISTS idx_data_tables_created_at ON data_tables(created_at);`
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_data_tables_created_at ON data_tables(created_at);`
+
+const createPipelinesTable = `
+CREATE TABLE IF NOT EXISTS pipelines (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    table_name VARCHAR(255) NOT NULL,
+    table_id UUID REFERENCES data_tables(id) ON DELETE SET NULL,
+    source_type VARCHAR(20) NOT NULL,
+    source TEXT NOT NULL,
+    pattern VARCHAR(255) NOT NULL DEFAULT '*.csv',
+    schedule VARCHAR(100) NOT NULL,
+    load_mode VARCHAR(20) NOT NULL DEFAULT 'append',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at TIMESTAMP,
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_pipelines_user_id ON pipelines(user_id);
+CREATE INDEX IF NOT EXISTS idx_pipelines_next_run_at ON pipelines(next_run_at) WHERE enabled;`
+
+const createPipelineRunsTable = `
+CREATE TABLE IF NOT EXISTS pipeline_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pipeline_id UUID REFERENCES pipelines(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    files_ingested INTEGER NOT NULL DEFAULT 0,
+    files_skipped INTEGER NOT NULL DEFAULT 0,
+    rows_imported INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_pipeline_runs_pipeline_id ON pipeline_runs(pipeline_id, started_at);`
+
+const createIngestedFilesTable = `
+CREATE TABLE IF NOT EXISTS ingested_files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pipeline_id UUID REFERENCES pipelines(id) ON DELETE CASCADE,
+    run_id UUID REFERENCES pipeline_runs(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_hash CHAR(64) NOT NULL,
+    rows_imported INTEGER NOT NULL DEFAULT 0,
+    ingested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (pipeline_id, content_hash)
+);`
+
+const addValidationColumns = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS validation_rules JSONB;
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS validation_report JSONB;`
+
+const createQuarantinedRowsTable = `
+CREATE TABLE IF NOT EXISTS quarantined_rows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    table_id UUID REFERENCES data_tables(id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    data JSONB NOT NULL,
+    errors JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_quarantined_rows_table_id ON quarantined_rows(table_id, created_at);`
+
+const addSchemaEvolutionColumns = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS schema_policy JSONB;
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;`
+
+const createSchemaVersionsTable = `
+CREATE TABLE IF NOT EXISTS schema_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    table_id UUID REFERENCES data_tables(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    table_schema JSONB NOT NULL,
+    changes JSONB NOT NULL DEFAULT '[]',
+    filename VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (table_id, version)
+);
+INSERT INTO schema_versions (table_id, version, table_schema, filename, created_at)
+SELECT id, 1, table_schema, original_filename, created_at
+FROM data_tables d
+WHERE NOT EXISTS (SELECT 1 FROM schema_versions sv WHERE sv.table_id = d.id);`
+
+const createTableVersionsTable = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS current_version INTEGER NOT NULL DEFAULT 1;
+CREATE TABLE IF NOT EXISTS table_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    table_id UUID REFERENCES data_tables(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    original_filename VARCHAR(255),
+    row_count INTEGER NOT NULL,
+    table_schema JSONB NOT NULL,
+    snapshot_table_name VARCHAR(255),
+    rolled_back_to INTEGER,
+    created_by UUID,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (table_id, version)
+);
+CREATE INDEX IF NOT EXISTS idx_table_versions_created_at ON table_versions(table_id, created_at);
+INSERT INTO table_versions (table_id, version, operation, original_filename, row_count, table_schema, created_by, created_at)
+SELECT id, 1, 'create', original_filename, row_count, table_schema, user_id, created_at
+FROM data_tables d
+WHERE NOT EXISTS (SELECT 1 FROM table_versions tv WHERE tv.table_id = d.id);`
+
+const addTableDescriptionColumn = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS description TEXT;`
+
+const addSoftDeleteColumns = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS trash_table_name VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_data_tables_deleted_at ON data_tables(deleted_at) WHERE deleted_at IS NOT NULL;`
+
+const createSharingTables = `
+CREATE TABLE IF NOT EXISTS user_groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id UUID REFERENCES user_groups(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members(user_id);
+CREATE TABLE IF NOT EXISTS table_shares (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    table_id UUID REFERENCES data_tables(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    group_id UUID REFERENCES user_groups(id) ON DELETE CASCADE,
+    permission VARCHAR(10) NOT NULL CHECK (permission IN ('viewer', 'editor', 'owner')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (group_id IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_table_shares_user ON table_shares(table_id, user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_table_shares_group ON table_shares(table_id, group_id) WHERE group_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_table_shares_user_id ON table_shares(user_id);
+CREATE INDEX IF NOT EXISTS idx_table_shares_group_id ON table_shares(group_id);`
+
+const createOrganizationTables = `
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'member', 'read_only')),
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE pipelines ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_data_tables_organization_id ON data_tables(organization_id);
+INSERT INTO organizations (name, personal, created_by)
+SELECT u.email, TRUE, u.id FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM organizations o WHERE o.personal AND o.created_by = u.id);
+INSERT INTO organization_members (organization_id, user_id, role)
+SELECT o.id, o.created_by, 'admin' FROM organizations o
+WHERE o.personal AND o.created_by IS NOT NULL
+ON CONFLICT DO NOTHING;
+UPDATE data_tables d SET organization_id = o.id
+FROM organizations o
+WHERE d.organization_id IS NULL AND o.personal AND o.created_by = d.user_id;
+UPDATE pipelines p SET organization_id = o.id
+FROM organizations o
+WHERE p.organization_id IS NULL AND o.personal AND o.created_by = p.user_id;`
+
+const addTableSchemaNameColumn = `
+ALTER TABLE data_tables ADD COLUMN IF NOT EXISTS schema_name VARCHAR(63);`
+
+const createSessionsTable = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id UUID REFERENCES organizations(id) ON DELETE SET NULL,
+    refresh_token_hash CHAR(64) UNIQUE NOT NULL,
+    previous_refresh_token_hash CHAR(64),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_refresh_token_hash ON sessions(previous_refresh_token_hash);`
+
+const createAPIKeysTable = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    scopes JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);`
+
+const addUserRoleColumns = `
+-- The oldest user becomes admin once, when roles are introduced, not on every start
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'role'
+    ) THEN
+        ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'editor'
+            CHECK (role IN ('admin', 'editor', 'viewer'));
+        UPDATE users SET role = 'admin'
+        WHERE id = (SELECT id FROM users ORDER BY created_at LIMIT 1);
+    END IF;
+END $$;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scopes JSONB;`
+
+const createOIDCTables = `
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash CHAR(64) PRIMARY KEY,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);`
+
+const createUserTokensTable = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE users ALTER COLUMN email_verified_at DROP DEFAULT;
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id);`
+
+const createMFATables = `
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    totp_secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+const createLoginFailuresTable = `
+CREATE TABLE IF NOT EXISTS login_failures (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP
+);`
+
+const addUserDisplayNameColumn = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(255);`
+
+const createAuditEventsTable = `
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID,
+    email VARCHAR(255),
+    api_key_id UUID,
+    action VARCHAR(255) NOT NULL,
+    resource_id VARCHAR(255),
+    ip VARCHAR(64),
+    user_agent TEXT,
+    status INTEGER NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'denied', 'failure'))
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource_id ON audit_events(resource_id, occurred_at);
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    -- Deleting an account erases who the person was from its events, and nothing else
+    IF TG_OP = 'UPDATE' AND NEW.email IS NULL AND NEW.ip IS NULL AND NEW.user_agent IS NULL
+        AND (NEW.id, NEW.occurred_at, NEW.user_id, NEW.api_key_id, NEW.action, NEW.resource_id, NEW.status, NEW.outcome)
+            IS NOT DISTINCT FROM (OLD.id, OLD.occurred_at, OLD.user_id, OLD.api_key_id, OLD.action, OLD.resource_id, OLD.status, OLD.outcome)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();`
+
+const createRateLimitBucketsTable = `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(320) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);`
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"etl-api/utils"
+	"fmt"
+)
+
+// tenantTable is a workspace table still stored in the public schema
+type tenantTable struct {
+	id             string
+	workspaceID    string
+	physicalName   string
+	trashTableName sql.NullString
+}
+
+// MoveTablesToTenantSchemas moves tables created before TENANT_SCHEMAS was turned on,
+// with their trash and version snapshots, into their workspace's schema
+func MoveTablesToTenantSchemas(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT id, organization_id, physical_table_name, trash_table_name
+		FROM data_tables
+		WHERE schema_name IS NULL AND organization_id IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %v", err)
+	}
+
+	var tables []tenantTable
+	for rows.Next() {
+		var table tenantTable
+		if err := rows.Scan(&table.id, &table.workspaceID, &table.physicalName, &table.trashTableName); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %v", err)
+	}
+
+	for _, table := range tables {
+		if err := moveTableToTenantSchema(db, table); err != nil {
+			return fmt.Errorf("failed to move table %s: %v", table.id, err)
+		}
+	}
+
+	return nil
+}
+
+// moveTableToTenantSchema moves one table and its snapshots in a single transaction
+func moveTableToTenantSchema(db *sql.DB, table tenantTable) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	schemaName := utils.TenantSchemaName(table.workspaceID)
+	if _, err := tx.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schemaName)); err != nil {
+		return err
+	}
+
+	// A trashed table only exists under its trash name
+	names := []string{table.physicalName}
+	if table.trashTableName.Valid {
+		names = []string{table.trashTableName.String}
+	}
+
+	snapshots, err := tx.Query(`
+		SELECT snapshot_table_name FROM table_versions
+		WHERE table_id = $1 AND snapshot_table_name IS NOT NULL
+	`, table.id)
+	if err != nil {
+		return err
+	}
+	for snapshots.Next() {
+		var name string
+		if err := snapshots.Scan(&name); err != nil {
+			snapshots.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	snapshots.Close()
+
+	for _, name := range names {
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE IF EXISTS public."%s" SET SCHEMA "%s"`, name, schemaName))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE data_tables SET schema_name = $1 WHERE id = $2`, schemaName, table.id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
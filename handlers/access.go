@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// permission is a user's access level on a table; higher levels include lower ones
+type permission int
+
+const (
+	permNone permission = iota
+	permViewer
+	permEditor
+	permOwner
+)
+
+var (
+	errTableNotFound = errors.New("table not found")
+	errForbidden     = errors.New("insufficient permissions")
+)
+
+// tablePermissionSQL computes the caller's permission level on the data_tables row
+// aliased d, with the caller's user ID bound to $1. Workspace admins are owners,
+// members editors and read-only members viewers; the uploader stays owner while
+// they can still write to the workspace. Shares, direct or via a group, can raise
+// the level further.
+const tablePermissionSQL = `GREATEST(
+		CASE WHEN d.user_id = $1 AND (d.organization_id IS NULL OR EXISTS (
+			SELECT 1 FROM organization_members om
+			WHERE om.organization_id = d.organization_id AND om.user_id = $1 AND om.role <> 'read_only'
+		)) THEN 3 ELSE 0 END,
+		COALESCE((
+			SELECT CASE om.role WHEN 'admin' THEN 3 WHEN 'member' THEN 2 ELSE 1 END
+			FROM organization_members om
+			WHERE om.organization_id = d.organization_id AND om.user_id = $1
+		), 0),
+		COALESCE((
+			SELECT MAX(CASE s.permission WHEN 'owner' THEN 3 WHEN 'editor' THEN 2 ELSE 1 END)
+			FROM table_shares s
+			WHERE s.table_id = d.id AND (s.user_id = $1 OR s.group_id IN (
+				SELECT group_id FROM group_members WHERE user_id = $1))
+		), 0)
+	)`
+
+// parsePermission converts a permission name from a request
+func parsePermission(name string) (permission, bool) {
+	switch name {
+	case "viewer":
+		return permViewer, true
+	case "editor":
+		return permEditor, true
+	case "owner":
+		return permOwner, true
+	}
+	return permNone, false
+}
+
+// String returns the permission name used in API responses
+func (p permission) String() string {
+	switch p {
+	case permViewer:
+		return "viewer"
+	case permEditor:
+		return "editor"
+	case permOwner:
+		return "owner"
+	}
+	return ""
+}
+
+// tablePermission returns the user's permission level on a live table
+func (h *Handlers) tablePermission(tableID, userID string) (permission, error) {
+	var level int
+	err := h.db.QueryRow(`
+		SELECT `+tablePermissionSQL+`
+		FROM data_tables d
+		WHERE d.id = $2 AND d.deleted_at IS NULL
+	`, userID, tableID).Scan(&level)
+	if err == sql.ErrNoRows {
+		return permNone, errTableNotFound
+	} else if err != nil {
+		return permNone, err
+	}
+	return permission(level), nil
+}
+
+// authorizeTable checks that the user holds at least the needed permission on a table.
+// Tables the user can't see at all are reported as not found.
+func (h *Handlers) authorizeTable(tableID, userID string, need permission) error {
+	level, err := h.tablePermission(tableID, userID)
+	if err != nil {
+		return err
+	}
+	if level == permNone {
+		return errTableNotFound
+	}
+	if level < need {
+		return errForbidden
+	}
+	return nil
+}
+
+// writeTableAccessError reports a failed table lookup or permission check
+func writeTableAccessError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errTableNotFound, sql.ErrNoRows:
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+	case errForbidden:
+		http.Error(w, `{"error": "Insufficient permissions for this table"}`, http.StatusForbidden)
+	default:
+		writeServerError(w, r, "Database error", err)
+	}
+}
@@ -0,0 +1,605 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// accountTable is a data table that goes with an account, with the name its rows live under
+type accountTable struct {
+	id, schemaName, storageName string
+}
+
+// loadProfile returns the user's own account as shown on /me
+func (h *Handlers) loadProfile(userID string) (*models.Profile, error) {
+	var profile models.Profile
+	err := h.db.QueryRow(`
+		SELECT id, email, COALESCE(display_name, ''), email_verified_at IS NOT NULL, password_hash <> '',
+			EXISTS (SELECT 1 FROM user_mfa WHERE user_id = users.id AND confirmed_at IS NOT NULL),
+			created_at, updated_at
+		FROM users WHERE id = $1
+	`, userID).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.EmailVerified,
+		&profile.HasPassword, &profile.MFAEnabled, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Role, profile.Scopes, err = h.userAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// GetProfile returns the authenticated user's account
+func (h *Handlers) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := h.loadProfile(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	profile.WorkspaceID = middleware.GetWorkspaceIDFromContext(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile changes the authenticated user's display name or email. A new email has
+// to be verified again.
+func (h *Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var email, passwordHash string
+	err := h.db.QueryRow(`SELECT email, password_hash FROM users WHERE id = $1`, userID).Scan(&email, &passwordHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if len(displayName) > 255 {
+			http.Error(w, `{"error": "display_name must be at most 255 characters"}`, http.StatusBadRequest)
+			return
+		}
+		_, err := tx.Exec(`
+			UPDATE users SET display_name = NULLIF($1, ''), updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		`, displayName, userID)
+		if err != nil {
+			writeServerError(w, r, "Failed to update profile", err)
+			return
+		}
+	}
+
+	emailChanged := req.Email != nil && *req.Email != email
+	if emailChanged {
+		if err := utils.ValidateEmail(*req.Email); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		// Whoever controls the email can reset the password, so changing it takes the password
+		if passwordHash != "" && !h.checkCurrentPassword(w, r, email, passwordHash, req.CurrentPassword) {
+			return
+		}
+
+		var taken bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)
+		`, *req.Email, userID).Scan(&taken)
+		if err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		if taken {
+			http.Error(w, `{"error": "User with this email already exists"}`, http.StatusConflict)
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE users SET email = $1, email_verified_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		`, *req.Email, userID)
+		if err != nil {
+			writeServerError(w, r, "Failed to update profile", err)
+			return
+		}
+
+		// The personal workspace is named after the email until the user renames it
+		_, err = tx.Exec(`
+			UPDATE organizations SET name = $1 WHERE personal AND created_by = $2 AND name = $3
+		`, *req.Email, userID, email)
+		if err != nil {
+			writeServerError(w, r, "Failed to update profile", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to update profile", err)
+		return
+	}
+
+	if emailChanged {
+		if err := h.sendVerificationEmail(userID, *req.Email); err != nil {
+			middleware.Logger(r).Error("Failed to send verification email", "error", err)
+		}
+	}
+
+	profile, err := h.loadProfile(userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	profile.WorkspaceID = middleware.GetWorkspaceIDFromContext(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// accountWorkspaces returns the workspaces that go with the account: those the user is
+// the only member of. It also names a workspace, if any, that other members would keep
+// using but the user is the last admin of, which blocks deleting the account.
+func accountWorkspaces(db dbExecutor, userID string) ([]string, string, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.name,
+			EXISTS (SELECT 1 FROM organization_members m2 WHERE m2.organization_id = o.id AND m2.user_id <> $1),
+			m.role = 'admin' AND NOT EXISTS (
+				SELECT 1 FROM organization_members m3
+				WHERE m3.organization_id = o.id AND m3.user_id <> $1 AND m3.role = 'admin'
+			)
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY m.added_at
+	`, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var workspaceIDs []string
+	var lastAdminOf string
+	for rows.Next() {
+		var id, name string
+		var othersRemain, lastAdmin bool
+		if err := rows.Scan(&id, &name, &othersRemain, &lastAdmin); err != nil {
+			return nil, "", err
+		}
+		if !othersRemain {
+			workspaceIDs = append(workspaceIDs, id)
+		} else if lastAdmin && lastAdminOf == "" {
+			lastAdminOf = name
+		}
+	}
+	return workspaceIDs, lastAdminOf, rows.Err()
+}
+
+// accountTables returns the tables that go with the account: every table in the
+// workspaces that go with it, and those the user owns outside any workspace
+func accountTables(db dbExecutor, userID string, workspaceIDs []string) ([]accountTable, error) {
+	return queryAccountTables(db, `
+		SELECT id, COALESCE(schema_name, ''),
+			CASE WHEN deleted_at IS NULL THEN physical_table_name ELSE trash_table_name END
+		FROM data_tables
+		WHERE organization_id::text = ANY (string_to_array($2, ','))
+			OR (organization_id IS NULL AND user_id = $1)
+		ORDER BY created_at
+	`, userID, workspaceIDs)
+}
+
+// sharedWorkspaceTables returns the tables the user owns in workspaces other members keep
+// using. They stay with the workspace when the account goes.
+func sharedWorkspaceTables(db dbExecutor, userID string, workspaceIDs []string) ([]accountTable, error) {
+	return queryAccountTables(db, `
+		SELECT id, COALESCE(schema_name, ''),
+			CASE WHEN deleted_at IS NULL THEN physical_table_name ELSE trash_table_name END
+		FROM data_tables
+		WHERE user_id = $1 AND organization_id IS NOT NULL
+			AND NOT organization_id::text = ANY (string_to_array($2, ','))
+		ORDER BY created_at
+	`, userID, workspaceIDs)
+}
+
+func queryAccountTables(db dbExecutor, query, userID string, workspaceIDs []string) ([]accountTable, error) {
+	rows, err := db.Query(query, userID, strings.Join(workspaceIDs, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []accountTable
+	for rows.Next() {
+		var table accountTable
+		if err := rows.Scan(&table.id, &table.schemaName, &table.storageName); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// DeleteAccount permanently deletes the authenticated user with all their data: the
+// workspaces only they belong to with their tables, and every credential. Tables they own
+// in workspaces with other members are handed to a workspace admin instead. It all happens
+// in one transaction, so a failure leaves the account as it was.
+func (h *Handlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var email, passwordHash string
+	err := h.db.QueryRow(`SELECT email, password_hash FROM users WHERE id = $1`, userID).Scan(&email, &passwordHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if passwordHash != "" && !h.checkCurrentPassword(w, r, email, passwordHash, req.Password) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	mfaEnabled, err := h.mfaEnabled(userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if mfaEnabled {
+		valid, err := verifyMFACode(tx, userID, req.Code)
+		if err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		if !valid {
+			http.Error(w, `{"error": "A valid MFA code is required to delete the account"}`, http.StatusForbidden)
+			return
+		}
+	}
+
+	// Hold the user's memberships and roles still while deciding what goes with the account.
+	// Locking the admins' rows too keeps two admins from deleting or demoting each other at
+	// once, without holding up logins and sign-ups.
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 OR role = 'admin' FOR UPDATE`, userID); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	_, err = tx.Exec(`
+		SELECT o.id FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		FOR UPDATE OF o
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	var lastAdmin bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE id = $1 AND role = 'admin' AND (scopes IS NULL OR scopes ? 'admin')
+		) AND NOT EXISTS (
+			SELECT 1 FROM users WHERE id <> $1 AND role = 'admin' AND (scopes IS NULL OR scopes ? 'admin')
+		)
+	`, userID).Scan(&lastAdmin)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if lastAdmin {
+		http.Error(w, `{"error": "At least one user must keep admin access; make another user admin first"}`, http.StatusConflict)
+		return
+	}
+
+	workspaceIDs, lastAdminOf, err := accountWorkspaces(tx, userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if lastAdminOf != "" {
+		http.Error(w, `{"error": "You are the last admin of an organization with other members; make another member admin first"}`, http.StatusConflict)
+		return
+	}
+
+	tables, err := accountTables(tx, userID, workspaceIDs)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	sharedTables, err := sharedWorkspaceTables(tx, userID, workspaceIDs)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// Other members still use the tables in their workspaces, so an admin takes them over
+	for _, table := range sharedTables {
+		_, err := tx.Exec(`
+			UPDATE data_tables d SET user_id = (
+				SELECT m.user_id FROM organization_members m
+				WHERE m.organization_id = d.organization_id AND m.user_id <> $2
+				ORDER BY m.role = 'admin' DESC, m.added_at
+				LIMIT 1
+			)
+			WHERE d.id = $1
+		`, table.id, userID)
+		if err != nil {
+			writeServerError(w, r, "Failed to transfer tables", err)
+			return
+		}
+	}
+
+	// Physical tables first: their metadata is the only record of their names
+	for _, table := range tables {
+		if err := dropTableStorage(tx, table.id, table.schemaName, table.storageName); err != nil {
+			writeServerError(w, r, "Failed to delete tables", err)
+			return
+		}
+		if _, err := tx.Exec(`DELETE FROM data_tables WHERE id = $1`, table.id); err != nil {
+			writeServerError(w, r, "Failed to delete tables", err)
+			return
+		}
+	}
+
+	// Then the emptied workspaces and their schemas
+	for _, workspaceID := range workspaceIDs {
+		if _, err := tx.Exec(`DELETE FROM organizations WHERE id = $1`, workspaceID); err != nil {
+			writeServerError(w, r, "Failed to delete workspaces", err)
+			return
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS "%s"`, utils.TenantSchemaName(workspaceID))); err != nil {
+			writeServerError(w, r, "Failed to delete workspaces", err)
+			return
+		}
+	}
+
+	// The audit log keeps what the account did under its bare user id, without the email,
+	// IP addresses and user agents that identify the person
+	_, err = tx.Exec(`
+		UPDATE audit_events SET email = NULL, ip = NULL, user_agent = NULL
+		WHERE (user_id = $1 OR LOWER(email) = LOWER($2))
+			AND (email IS NOT NULL OR ip IS NOT NULL OR user_agent IS NOT NULL)
+	`, userID, email)
+	if err != nil {
+		writeServerError(w, r, "Failed to delete account", err)
+		return
+	}
+
+	// Finally the user; sessions, API keys, MFA, memberships, groups and pipelines go with it
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		writeServerError(w, r, "Failed to delete account", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to delete account", err)
+		return
+	}
+
+	if err := h.clearLoginFailures(email); err != nil {
+		middleware.Logger(r).Error("Failed to clear login failures", "error", err)
+	}
+	middleware.ForgetAuditUser(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.DeleteAccountResponse{
+		Message:           "Account deleted",
+		TablesDeleted:     len(tables),
+		TablesTransferred: len(sharedTables),
+		WorkspacesDeleted: len(workspaceIDs),
+	})
+}
+
+// accountExportSections are the records tied to a user, exported next to the profile and
+// tables; credentials are listed without their secrets
+var accountExportSections = []struct {
+	name, query string
+}{
+	{"workspaces", `
+		SELECT o.id, o.name, o.personal, m.role, m.added_at
+		FROM organization_members m JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1 ORDER BY m.added_at`},
+	{"groups", `
+		SELECT g.id, g.name, g.owner_id = $1 AS owner, g.created_at FROM user_groups g
+		WHERE g.owner_id = $1 OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = $1)
+		ORDER BY g.created_at`},
+	{"shared_with_me", `
+		SELECT table_id, permission, created_at FROM table_shares WHERE user_id = $1 ORDER BY created_at`},
+	{"pipelines", `
+		SELECT id, name, table_name, table_id, source_type, source, pattern, schedule, load_mode, enabled, last_run_at, created_at
+		FROM pipelines WHERE user_id = $1 ORDER BY created_at`},
+	{"pipeline_runs", `
+		SELECT r.* FROM pipeline_runs r JOIN pipelines p ON p.id = r.pipeline_id
+		WHERE p.user_id = $1 ORDER BY r.started_at`},
+	{"sessions", `
+		SELECT id, workspace_id, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`},
+	{"api_keys", `
+		SELECT id, name, key_prefix, workspace_id, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at`},
+	{"identities", `
+		SELECT issuer, subject, created_at FROM user_identities WHERE user_id = $1 ORDER BY created_at`},
+	{"audit_events", `
+		SELECT id, occurred_at, action, resource_id, ip, user_agent, status, outcome
+		FROM audit_events WHERE user_id = $1 ORDER BY id`},
+}
+
+// ExportAccount streams everything tied to the authenticated user as one JSON document:
+// the profile, memberships, credentials metadata, and every table DELETE /me would delete,
+// with all its rows. Once streaming has started errors can only cut the document short.
+func (h *Handlers) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	profile, err := h.loadProfile(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// Read everything from one snapshot so the export is consistent
+	tx, err := h.db.BeginTx(r.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	sections := make(map[string]json.RawMessage, len(accountExportSections))
+	for _, section := range accountExportSections {
+		var data []byte
+		err := tx.QueryRow(`SELECT COALESCE(json_agg(x), '[]') FROM (`+section.query+`) x`, userID).Scan(&data)
+		if err != nil {
+			writeServerError(w, r, "Failed to export account", err)
+			return
+		}
+		sections[section.name] = data
+	}
+
+	workspaceIDs, _, err := accountWorkspaces(tx, userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	tables, err := accountTables(tx, userID, workspaceIDs)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	sharedTables, err := sharedWorkspaceTables(tx, userID, workspaceIDs)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	tables = append(tables, sharedTables...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="etl-api-export-%s.json"`, time.Now().UTC().Format("20060102")))
+
+	header, _ := json.Marshal(map[string]interface{}{
+		"exported_at": time.Now().UTC(),
+		"profile":     profile,
+	})
+	w.Write(header[:len(header)-1])
+	for _, section := range accountExportSections {
+		fmt.Fprintf(w, `,"%s":%s`, section.name, sections[section.name])
+	}
+
+	w.Write([]byte(`,"tables":[`))
+	for i, table := range tables {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := exportTable(tx, w, table); err != nil {
+			middleware.Logger(r).Error("Failed to export table", "error", err, "table_id", table.id)
+			return
+		}
+	}
+	w.Write([]byte("]}\n"))
+}
+
+// exportTable writes one table's metadata and rows as a JSON object
+func exportTable(tx *sql.Tx, w http.ResponseWriter, table accountTable) error {
+	var metadata []byte
+	err := tx.QueryRow(`
+		SELECT row_to_json(x) FROM (
+			SELECT id, table_name, description, original_filename, organization_id, column_count, row_count,
+				table_schema, current_version, created_at, deleted_at
+			FROM data_tables WHERE id = $1
+		) x
+	`, table.id).Scan(&metadata)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf(`SELECT row_to_json(t) FROM %s t ORDER BY id`, utils.QuoteTableName(table.schemaName, table.storageName)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	fmt.Fprintf(w, `{"table":%s,"rows":[`, metadata)
+	for first := true; rows.Next(); first = false {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return err
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		w.Write(row)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	w.Write([]byte("]}"))
+	return nil
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyUsageInterval is how stale last_used_at may get before a request refreshes it
+const apiKeyUsageInterval = time.Minute
+
+// requireLogin rejects requests made with an API key, so keys can't manage keys
+func requireLogin(w http.ResponseWriter, r *http.Request) bool {
+	if middleware.GetAPIKeyIDFromContext(r) != "" {
+		http.Error(w, `{"error": "API keys can't be used for this endpoint; log in instead"}`, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// scanAPIKey reads an API key selected as id, name, key_prefix, workspace_id, scopes, expires_at, last_used_at, created_at
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopesJSON []byte
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.WorkspaceID, &scopesJSON,
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopesJSON, &key.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to parse scopes: %v", err)
+	}
+	return &key, nil
+}
+
+// CreateAPIKey creates a named API key for the authenticated user in their current workspace
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		http.Error(w, `{"error": "Key name is required and must be at most 255 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	scopes := []string{}
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !middleware.ValidScope(scope) {
+			writeError(w, http.StatusBadRequest, "Unknown scope "+scope+"; use read, upload, write, delete or admin", "")
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+
+	var expiresAt interface{}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, `{"error": "expires_at must be in the future"}`, http.StatusBadRequest)
+			return
+		}
+		expiresAt = req.ExpiresAt.UTC()
+	}
+
+	key, err := utils.GenerateAPIKey()
+	if err != nil {
+		writeServerError(w, r, "Failed to generate API key", err)
+		return
+	}
+	scopesJSON, _ := json.Marshal(scopes)
+
+	var workspaceID interface{}
+	if ws := middleware.GetWorkspaceIDFromContext(r); ws != "" {
+		workspaceID = ws
+	}
+
+	created, err := scanAPIKey(h.db.QueryRow(`
+		INSERT INTO api_keys (user_id, workspace_id, name, key_prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, name, key_prefix, workspace_id, scopes, expires_at, last_used_at, created_at
+	`, userID, workspaceID, req.Name, key[:12], utils.HashToken(key), scopesJSON, expiresAt))
+	if err != nil {
+		writeServerError(w, r, "Failed to create API key", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreateAPIKeyResponse{APIKey: *created, Key: key})
+}
+
+// ListAPIKeys returns the authenticated user's active API keys
+func (h *Handlers) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, name, key_prefix, workspace_id, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve API keys", err)
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			writeServerError(w, r, "Failed to scan API key", err)
+			return
+		}
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.APIKeyListResponse{
+		Keys:  keys,
+		Total: len(keys),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeAPIKey permanently disables one of the authenticated user's API keys
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	keyID := mux.Vars(r)["id"]
+
+	result, err := h.db.Exec(`
+		UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to revoke API key", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "API key not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message": "API key revoked",
+		"key_id":  keyID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// AuthenticateAPIKey looks up an API key for the auth middleware and records that it was used
+func (h *Handlers) AuthenticateAPIKey(key string) (*middleware.APIKeyIdentity, error) {
+	if !strings.HasPrefix(key, utils.APIKeyPrefix) {
+		return nil, nil
+	}
+
+	var identity middleware.APIKeyIdentity
+	var workspaceID sql.NullString
+	var scopesJSON []byte
+	var stale bool
+	err := h.db.QueryRow(`
+		SELECT k.id, k.user_id, u.email, k.workspace_id, k.scopes,
+			k.last_used_at IS NULL OR k.last_used_at < CURRENT_TIMESTAMP - make_interval(secs => $2)
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+			AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)
+	`, utils.HashToken(key), apiKeyUsageInterval.Seconds()).Scan(&identity.KeyID, &identity.UserID, &identity.Email,
+		&workspaceID, &scopesJSON, &stale)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	identity.WorkspaceID = workspaceID.String
+
+	var keyScopes []string
+	if err := json.Unmarshal(scopesJSON, &keyScopes); err != nil {
+		return nil, fmt.Errorf("failed to parse scopes: %v", err)
+	}
+
+	// A key can never do more than its owner's role currently allows
+	_, identity.Scopes, err = h.userAccess(identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyScopes) > 0 {
+		identity.Scopes = intersectScopes(keyScopes, identity.Scopes)
+	}
+
+	// Busy keys only need last_used_at to be roughly right
+	if stale {
+		if _, err := h.db.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`, identity.KeyID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &identity, nil
+}
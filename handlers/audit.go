@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordAuditEvent appends an event to the audit log
+func (h *Handlers) RecordAuditEvent(event middleware.AuditEvent) error {
+	_, err := h.db.Exec(`
+		INSERT INTO audit_events (user_id, email, api_key_id, action, resource_id, ip, user_agent, status, outcome)
+		VALUES (NULLIF($1, '')::uuid, NULLIF($2, ''), NULLIF($3, '')::uuid, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9)
+	`, event.UserID, event.Email, event.APIKeyID, event.Action, event.ResourceID, event.IP, event.UserAgent,
+		event.Status, event.Outcome)
+	return err
+}
+
+// ListAuditEvents lists everyone's audit events, for admins. Filters: user_id, email,
+// action, resource_id, outcome, ip, since and until.
+func (h *Handlers) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	h.listAuditEvents(w, r, "")
+}
+
+// ListMyAuditEvents lists the authenticated user's own audit events, with the same filters
+func (h *Handlers) ListMyAuditEvents(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	h.listAuditEvents(w, r, userID)
+}
+
+// listAuditEvents writes a page of audit events, newest first, limited to one user's if userID is set
+func (h *Handlers) listAuditEvents(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+
+	var conditions []string
+	var args []interface{}
+	filter := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if userID != "" {
+		filter("user_id = $%d", userID)
+	} else if v := query.Get("user_id"); v != "" {
+		filter("user_id::text = $%d", v)
+	}
+	if v := query.Get("email"); v != "" {
+		filter("LOWER(email) = LOWER($%d)", v)
+	}
+	if v := query.Get("action"); v != "" {
+		filter("action = $%d", v)
+	}
+	if v := query.Get("resource_id"); v != "" {
+		filter("resource_id = $%d", v)
+	}
+	if v := query.Get("ip"); v != "" {
+		filter("ip = $%d", v)
+	}
+	if v := query.Get("outcome"); v != "" {
+		switch v {
+		case middleware.AuditSuccess, middleware.AuditDenied, middleware.AuditFailure:
+			filter("outcome = $%d", v)
+		default:
+			http.Error(w, `{"error": "outcome must be success, denied or failure"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	for param, condition := range map[string]string{"since": "occurred_at >= $%d", "until": "occurred_at < $%d"} {
+		if v := query.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error": "%s must be an RFC 3339 timestamp"}`, param), http.StatusBadRequest)
+				return
+			}
+			filter(condition, t.UTC())
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error": "before must be an event id"}`, http.StatusBadRequest)
+			return
+		}
+		filter("id < $%d", before)
+	}
+
+	limit := 100
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit+1)
+	rows, err := h.db.Query(fmt.Sprintf(`
+		SELECT id, occurred_at, user_id, email, api_key_id, action, resource_id, ip, user_agent, status, outcome
+		FROM audit_events
+		%s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, where, len(args)), args...)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer rows.Close()
+
+	response := models.AuditEventListResponse{Events: []models.AuditEvent{}}
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(&event.ID, &event.OccurredAt, &event.UserID, &event.Email, &event.APIKeyID,
+			&event.Action, &event.ResourceID, &event.IP, &event.UserAgent, &event.Status, &event.Outcome); err != nil {
+			writeServerError(w, r, "Failed to scan audit event", err)
+			return
+		}
+		response.Events = append(response.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// One extra row tells whether there is another page
+	if len(response.Events) > limit {
+		response.Events = response.Events[:limit]
+		next := response.Events[limit-1].ID
+		response.NextBefore = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
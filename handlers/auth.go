@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"etl-api/middleware"
 	"etl-api/models"
 	"etl-api/utils"
 	"fmt"
@@ -11,6 +12,54 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// createUser inserts a user with their personal workspace and returns both IDs.
+// The first user of a new deployment becomes its admin, and nobody after them does even
+// if the admins are gone; db must be a transaction for that to hold when several users
+// sign up at once.
+func createUser(db dbExecutor, email, passwordHash string) (string, string, error) {
+	// While there are no users, sign-ups take turns so only the first one becomes admin
+	var usersExist bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users)`).Scan(&usersExist); err != nil {
+		return "", "", err
+	}
+	if !usersExist {
+		if _, err := db.Exec(`SELECT pg_advisory_xact_lock(hashtext('first-admin'))`); err != nil {
+			return "", "", err
+		}
+	}
+
+	var userID string
+	err := db.QueryRow(`
+		INSERT INTO users (email, password_hash, role)
+		VALUES ($1, $2, CASE WHEN EXISTS (SELECT 1 FROM users) THEN 'editor' ELSE 'admin' END)
+		RETURNING id
+	`, email, passwordHash).Scan(&userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Every user starts with a personal workspace
+	workspaceID, err := createPersonalWorkspace(db, userID, email)
+	if err != nil {
+		return "", "", err
+	}
+
+	return userID, workspaceID, nil
+}
+
+// dummyPasswordHash is compared against when the email is unknown, so those logins take
+// as long as ones with a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// failLogin records a failed login and answers with the same error whatever went wrong
+func (h *Handlers) failLogin(w http.ResponseWriter, r *http.Request, email, clientIP string) {
+	if err := h.recordLoginFailure(email, clientIP); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
+}
+
 // Register handles user registration
 func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
@@ -25,7 +74,7 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := utils.ValidatePassword(req.Password); err != nil {
+	if err := utils.ValidatePassword(req.Password, req.Email); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
@@ -37,36 +86,50 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "User with this email already exists"}`, http.StatusConflict)
 		return
 	} else if err != sql.ErrNoRows {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to process password"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to process password", err)
 		return
 	}
 
-	// Insert user
-	var userID string
-	err = h.db.QueryRow(`
-		INSERT INTO users (email, password_hash) 
-		VALUES ($1, $2) 
-		RETURNING id
-	`, req.Email, string(hashedPassword)).Scan(&userID)
-	
+	tx, err := h.db.Begin()
 	if err != nil {
-		http.Error(w, `{"error": "Failed to create user"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Insert user with their personal workspace
+	userID, workspaceID, err := createUser(tx, req.Email, string(hashedPassword))
+	if err != nil {
+		writeServerError(w, r, "Failed to create user", err)
+		return
+	}
+	middleware.SetAuditUser(r, userID, req.Email)
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to create user", err)
 		return
 	}
 
+	// The account works right away unless REQUIRE_EMAIL_VERIFICATION is set, so a
+	// lost email shouldn't fail the registration
+	if err := h.sendVerificationEmail(userID, req.Email); err != nil {
+		middleware.Logger(r).Error("Failed to send verification email", "error", err)
+	}
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	response := map[string]string{
-		"message": "User registered successfully",
-		"user_id": userID,
+		"message":      "User registered successfully; check your email to verify your address",
+		"user_id":      userID,
+		"workspace_id": workspaceID,
 	}
 	json.NewEncoder(w).Encode(response)
 }
@@ -79,6 +142,9 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Attempts are audited under the email they tried, known or not
+	middleware.SetAuditUser(r, "", req.Email)
+
 	// Validate input
 	if err := utils.ValidateEmail(req.Email); err != nil {
 		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
@@ -90,40 +156,171 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Held-back accounts and clients are refused before the password is even checked
+	clientIP := middleware.GetClientIP(r)
+	retryAfter, err := h.beginLoginAttempt(req.Email, clientIP)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
+
 	// Get user from database
 	var user models.User
-	err := h.db.QueryRow(`
-		SELECT id, email, password_hash 
+	var emailVerified bool
+	err = h.db.QueryRow(`
+		SELECT id, email, password_hash, email_verified_at IS NOT NULL
 		FROM users 
 		WHERE email = $1
-	`, req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash)
+	`, req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &emailVerified)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
+		// Spend the same time on unknown emails as on wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		h.failLogin(w, r, req.Email, clientIP)
 		return
 	} else if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
 		return
 	}
+	middleware.SetAuditUser(r, user.ID, user.Email)
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
+		h.failLogin(w, r, req.Email, clientIP)
+		return
+	}
+	if err := h.endLoginAttempt(req.Email, clientIP); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if !emailVerified && utils.EmailVerificationRequired() {
+		http.Error(w, `{"error": "Verify your email address before logging in"}`, http.StatusForbidden)
+		return
+	}
+
+	// Pick the workspace the token is scoped to
+	workspaceID, err := h.resolveWorkspace(user.ID, req.WorkspaceID)
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Not a member of the requested workspace"}`, http.StatusForbidden)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// With MFA on, the password only earns a challenge that POST /auth/mfa exchanges for tokens
+	if h.startMFAChallenge(w, r, user.ID, workspaceID) {
+		return
+	}
+
+	if err := h.clearLoginFailures(req.Email); err != nil {
+		writeServerError(w, r, "Database error", err)
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	// Start a session; the access token carries its ID and the refresh token renews it
+	sessionID, refreshToken, err := h.createSession(user.ID, workspaceID)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to create session", err)
 		return
 	}
 
-	// Return token
-	w.Header().Set("Content-Type", "application/json")
-	response := models.AuthResponse{
-		Token:     token,
-		ExpiresIn: 86400, // 24 hours in seconds
+	h.writeAuthResponse(w, r, user.ID, user.Email, workspaceID, sessionID, refreshToken)
+}
+
+// ChangePassword sets a new password after checking the current one, and logs out the
+// user's other sessions
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
 	}
-	json.NewEncoder(w).Encode(response)
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var email, passwordHash string
+	err := h.db.QueryRow(`SELECT email, password_hash FROM users WHERE id = $1`, userID).Scan(&email, &passwordHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if passwordHash == "" {
+		http.Error(w, `{"error": "This account signs in through single sign-on and has no password"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, email, passwordHash, req.CurrentPassword) {
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		http.Error(w, `{"error": "New password must differ from the current one"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.ValidatePassword(req.NewPassword, email); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		writeServerError(w, r, "Failed to process password", err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, string(hashedPassword), userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to change password", err)
+		return
+	}
+
+	// Keep the session that changed the password; end the others
+	_, err = tx.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2
+	`, userID, middleware.GetSessionIDFromContext(r))
+	if err != nil {
+		writeServerError(w, r, "Failed to change password", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to change password", err)
+		return
+	}
+
+	if err := h.clearLoginFailures(email); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed; your other sessions were logged out"})
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"etl-api/middleware"
 	"etl-api/models"
+	"etl-api/utils"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -22,16 +23,24 @@ func (h *Handlers) ListTables(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query user's tables
+	workspaceID := middleware.GetWorkspaceIDFromContext(r)
+
+	// Query the current workspace's tables and the tables shared with the user
 	rows, err := h.db.Query(`
-		SELECT id, table_name, original_filename, column_count, row_count, created_at
-		FROM data_tables 
-		WHERE user_id = $1
+		SELECT * FROM (
+			SELECT d.id, d.table_name, d.description, d.original_filename, d.column_count, d.row_count,
+				d.created_at, d.organization_id IS DISTINCT FROM NULLIF($2, '')::uuid AS shared, `+tablePermissionSQL+` AS permission
+			FROM data_tables d
+			WHERE d.deleted_at IS NULL AND (d.organization_id = NULLIF($2, '')::uuid OR d.id IN (
+				SELECT table_id FROM table_shares
+				WHERE user_id = $1 OR group_id IN (SELECT group_id FROM group_members WHERE user_id = $1)))
+		) t
+		WHERE permission > 0
 		ORDER BY created_at DESC
-	`, userID)
+	`, userID, workspaceID)
 
 	if err != nil {
-		http.Error(w, `{"error": "Failed to retrieve tables"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to retrieve tables", err)
 		return
 	}
 	defer rows.Close()
@@ -39,15 +48,18 @@ func (h *Handlers) ListTables(w http.ResponseWriter, r *http.Request) {
 	var tables []models.DataTableSummary
 	for rows.Next() {
 		var table models.DataTableSummary
-		if err := rows.Scan(&table.ID, &table.Name, &table.Filename, &table.Columns, &table.Rows, &table.CreatedAt); err != nil {
-			http.Error(w, `{"error": "Failed to scan table data"}`, http.StatusInternalServerError)
+		var level int
+		if err := rows.Scan(&table.ID, &table.Name, &table.Description, &table.Filename, &table.Columns, &table.Rows,
+			&table.CreatedAt, &table.Shared, &level); err != nil {
+			writeServerError(w, r, "Failed to scan table data", err)
 			return
 		}
+		table.Permission = permission(level).String()
 		tables = append(tables, table)
 	}
 
 	if err := rows.Err(); err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
 		return
 	}
 
@@ -60,7 +72,7 @@ func (h *Handlers) ListTables(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// DeleteTable removes a table and its data
+// DeleteTable moves a table to the trash, where it is kept until purged
 func (h *Handlers) DeleteTable(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID := middleware.GetUserIDFromContext(r)
@@ -72,39 +84,60 @@ func (h *Handlers) DeleteTable(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tableID := vars["id"]
 
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
 	// Get table info to verify ownership and get physical table name
-	var physicalTableName string
-	err := h.db.QueryRow(`
-		SELECT physical_table_name 
+	var schemaName, physicalTableName string
+	err = tx.QueryRow(`
+		SELECT COALESCE(schema_name, ''), physical_table_name 
 		FROM data_tables 
-		WHERE id = $1 AND user_id = $2
-	`, tableID, userID).Scan(&physicalTableName)
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, tableID).Scan(&schemaName, &physicalTableName)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
 		return
 	}
 
-	// Drop the physical table
-	_, err = h.db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, physicalTableName))
+	// Move the physical table out of the way so the name can be reused
+	trashTableName := utils.TrashTableName(tableID)
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME TO "%s"`, utils.QuoteTableName(schemaName, physicalTableName), trashTableName))
 	if err != nil {
-		http.Error(w, `{"error": "Failed to drop table"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to move table to trash", err)
 		return
 	}
 
-	// Delete metadata
-	_, err = h.db.Exec(`DELETE FROM data_tables WHERE id = $1 AND user_id = $2`, tableID, userID)
+	_, err = tx.Exec(`
+		UPDATE data_tables SET deleted_at = CURRENT_TIMESTAMP, trash_table_name = $1
+		WHERE id = $2
+	`, trashTableName, tableID)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to delete table metadata"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to update table metadata", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit table deletion", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
-		"message":  "Table deleted successfully",
+		"message":  "Table moved to trash",
 		"table_id": tableID,
 	}
 	json.NewEncoder(w).Encode(response)
@@ -138,27 +171,54 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := h.authorizeTable(tableID, userID, permViewer); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
 	// Get table metadata
 	var table models.DataTable
 	var schemaJSON []byte
+	var schemaName string
+	var version int
 	err := h.db.QueryRow(`
-		SELECT id, table_name, original_filename, column_count, row_count, table_schema, physical_table_name
+		SELECT id, table_name, original_filename, column_count, row_count, table_schema, COALESCE(schema_name, ''), physical_table_name, current_version
 		FROM data_tables 
-		WHERE id = $1 AND user_id = $2
-	`, tableID, userID).Scan(&table.ID, &table.TableName, &table.OriginalFilename, 
-		&table.ColumnCount, &table.RowCount, &schemaJSON, &table.PhysicalTableName)
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tableID).Scan(&table.ID, &table.TableName, &table.OriginalFilename,
+		&table.ColumnCount, &table.RowCount, &schemaJSON, &schemaName, &table.PhysicalTableName, &version)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// Time-travel reads come from a frozen snapshot of an older version
+	tableRef := utils.QuoteTableName(schemaName, table.PhysicalTableName)
+	source, err := h.resolveTableVersion(r, table.ID, schemaName, version)
+	if err == errInvalidVersion {
+		http.Error(w, `{"error": "Invalid version or as_of parameter"}`, http.StatusBadRequest)
+		return
+	} else if err == errVersionNotFound {
+		http.Error(w, `{"error": "Version not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
 		return
 	}
+	if source != nil {
+		version = source.Version
+		schemaJSON = source.SchemaJSON
+		table.RowCount = source.RowCount
+		tableRef = source.TableRef
+	}
 
 	// Parse table schema
 	if err := json.Unmarshal(schemaJSON, &table.TableSchema); err != nil {
-		http.Error(w, `{"error": "Failed to parse table schema"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to parse table schema", err)
 		return
 	}
 
@@ -177,24 +237,25 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 	// Calculate offset
 	offset := (page - 1) * limit
 
-	// Query data with pagination
+	// Query data with pagination, including the row id used by the row endpoints
 	query := fmt.Sprintf(`
-		SELECT %s 
-		FROM "%s" 
+		SELECT id, %s 
+		FROM %s 
 		ORDER BY id 
 		LIMIT $1 OFFSET $2
-	`, strings.Join(quotedColumns, ", "), table.PhysicalTableName)
+	`, strings.Join(quotedColumns, ", "), tableRef)
 
 	rows, err := h.db.Query(query, limit, offset)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to query table data"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Failed to query table data", err)
 		return
 	}
 	defer rows.Close()
 
-	// Prepare data structure
+	// Prepare data structure; row ids are listed apart so rows keep the table's columns
 	var data []map[string]interface{}
-	
+	rowIDs := []int64{}
+
 	for rows.Next() {
 		// Create slice for values
 		values := make([]interface{}, len(columns))
@@ -204,8 +265,9 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Scan row
-		if err := rows.Scan(valuePtrs...); err != nil {
-			http.Error(w, `{"error": "Failed to scan row data"}`, http.StatusInternalServerError)
+		var rowID int64
+		if err := rows.Scan(append([]interface{}{&rowID}, valuePtrs...)...); err != nil {
+			writeServerError(w, r, "Failed to scan row data", err)
 			return
 		}
 
@@ -223,10 +285,11 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		data = append(data, rowData)
+		rowIDs = append(rowIDs, rowID)
 	}
 
 	if err := rows.Err(); err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		writeServerError(w, r, "Database error", err)
 		return
 	}
 
@@ -241,8 +304,10 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 			Name:      table.TableName,
 			TotalRows: table.RowCount,
 			Columns:   columns,
+			Version:   version,
 		},
-		Data: data,
+		Data:   data,
+		RowIDs: rowIDs,
 		Pagination: models.PaginationInfo{
 			CurrentPage: page,
 			PerPage:     limit,
@@ -253,4 +318,4 @@ func (h *Handlers) GetTableData(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateGroup creates a group owned by the authenticated user, who is its first member
+func (h *Handlers) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		http.Error(w, `{"error": "Group name is required and must be at most 255 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	group := models.Group{Name: req.Name, OwnerID: userID}
+	err = tx.QueryRow(`
+		INSERT INTO user_groups (owner_id, name) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, userID, req.Name).Scan(&group.ID, &group.CreatedAt)
+	if err != nil {
+		writeServerError(w, r, "Failed to create group", err)
+		return
+	}
+
+	var member models.GroupMember
+	err = tx.QueryRow(`
+		INSERT INTO group_members (group_id, user_id) VALUES ($1, $2)
+		RETURNING user_id, (SELECT email FROM users WHERE id = $2), added_at
+	`, group.ID, userID).Scan(&member.UserID, &member.Email, &member.AddedAt)
+	if err != nil {
+		writeServerError(w, r, "Failed to add group member", err)
+		return
+	}
+	group.Members = []models.GroupMember{member}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit group", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+// ListGroups returns the groups the authenticated user owns or belongs to
+func (h *Handlers) ListGroups(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT g.id, g.name, g.owner_id, g.created_at, m.user_id, u.email, m.added_at
+		FROM user_groups g
+		LEFT JOIN group_members m ON m.group_id = g.id
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE g.owner_id = $1 OR g.id IN (SELECT group_id FROM group_members WHERE user_id = $1)
+		ORDER BY g.created_at, m.added_at
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve groups", err)
+		return
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var group models.Group
+		var memberID, memberEmail sql.NullString
+		var addedAt sql.NullTime
+		if err := rows.Scan(&group.ID, &group.Name, &group.OwnerID, &group.CreatedAt, &memberID, &memberEmail, &addedAt); err != nil {
+			writeServerError(w, r, "Failed to scan group", err)
+			return
+		}
+
+		i, ok := index[group.ID]
+		if !ok {
+			group.Members = []models.GroupMember{}
+			groups = append(groups, group)
+			i = len(groups) - 1
+			index[group.ID] = i
+		}
+		if memberID.Valid {
+			groups[i].Members = append(groups[i].Members, models.GroupMember{
+				UserID:  memberID.String,
+				Email:   memberEmail.String,
+				AddedAt: addedAt.Time,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.GroupListResponse{
+		Groups: groups,
+		Total:  len(groups),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteGroup removes a group and every table share granted to it
+func (h *Handlers) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	groupID := mux.Vars(r)["id"]
+
+	result, err := h.db.Exec(`DELETE FROM user_groups WHERE id = $1 AND owner_id = $2`, groupID, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to delete group", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Group not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":  "Group deleted successfully",
+		"group_id": groupID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// AddGroupMember adds a registered user to a group owned by the authenticated user
+func (h *Handlers) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	groupID := mux.Vars(r)["id"]
+
+	var req models.AddGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	var ownerID string
+	err := h.db.QueryRow(`SELECT owner_id FROM user_groups WHERE id = $1 AND owner_id = $2`, groupID, userID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Group not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// The answer is the same whether or not the email has an account or is already a
+	// member, so groups can't be used to find out who is registered
+	_, err = h.db.Exec(`
+		INSERT INTO group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE email = $2
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, req.Email)
+	if err != nil {
+		writeServerError(w, r, "Failed to add group member", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	response := map[string]string{
+		"message":  "If the email belongs to a registered user, they are a member of the group",
+		"group_id": groupID,
+		"email":    req.Email,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RemoveGroupMember removes a user from a group owned by the authenticated user
+func (h *Handlers) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupID := vars["id"]
+	memberID := vars["user_id"]
+
+	result, err := h.db.Exec(`
+		DELETE FROM group_members m
+		USING user_groups g
+		WHERE m.group_id = g.id AND g.id = $1 AND g.owner_id = $2 AND m.user_id = $3
+	`, groupID, userID, memberID)
+	if err != nil {
+		writeServerError(w, r, "Failed to remove group member", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Group member not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":  "Group member removed",
+		"group_id": groupID,
+		"user_id":  memberID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -3,18 +3,66 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/utils"
+	"fmt"
 	"net/http"
+
+	"github.com/lib/pq"
 )
 
 // Handlers holds dependencies for HTTP handlers
 type Handlers struct {
-	db *sql.DB
+	db     *sql.DB
+	oidc   *utils.OIDCProvider
+	mailer utils.Mailer
+}
+
+// dbExecutor is satisfied by both *sql.DB and *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// writeServerError logs what went wrong, tagged with the request, and answers 500 with a
+// message that leaves out the details
+func writeServerError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	middleware.Logger(r).Error(message, "error", err)
+	http.Error(w, fmt.Sprintf(`{"error": "%s"}`, message), http.StatusInternalServerError)
+}
+
+// writeError answers with an error message and an optional detail, encoded so that
+// quotes in either, e.g. from user input or a Postgres error, keep the body valid JSON
+func writeError(w http.ResponseWriter, code int, message, detail string) {
+	body := map[string]string{"error": message}
+	if detail != "" {
+		body["detail"] = detail
+	}
+	encoded, _ := json.Marshal(body)
+	http.Error(w, string(encoded), code)
+}
+
+// invalidValueError returns the Postgres error when the values written caused it, such
+// as a failed cast or a violated constraint, rather than something on the server side
+func invalidValueError(err error) (*pq.Error, bool) {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return nil, false
+	}
+	switch pqErr.Code.Class() {
+	case "22", "23": // data exception, integrity constraint violation
+		return pqErr, true
+	}
+	return nil, false
 }
 
 // NewHandlers creates a new handlers instance
-func NewHandlers(db *sql.DB) *Handlers {
+func NewHandlers(db *sql.DB, mailer utils.Mailer) *Handlers {
 	return &Handlers{
-		db: db,
+		db:     db,
+		oidc:   utils.NewOIDCProviderFromEnv(),
+		mailer: mailer,
 	}
 }
 
@@ -27,4 +75,11 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 		"version": "1.0.0",
 	}
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// JWKS serves the public keys other services use to verify our access tokens
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.JWKS())
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"database/sql"
+	"etl-api/database"
+	"etl-api/utils"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL and migrates it, skipping the
+// test when none is configured. Tests share the database, so they use unique emails.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	// Tokens are signed with a throwaway key
+	t.Setenv("APP_ENV", "development")
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatalf("failed to load signing keys: %v", err)
+	}
+
+	return db
+}
+
+// testEmail returns an email no other test run has used
+func testEmail(name string) string {
+	return fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano())
+}
@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"encoding/json"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"strings"
+)
+
+// loadResult summarises a completed import into a table
+type loadResult struct {
+	TableID         string
+	RowsImported    int
+	RowsQuarantined int
+	Report          *models.ValidationReport
+	SchemaChanges   []models.SchemaChange
+	Version         int
+}
+
+// validationError is returned when a file is rejected by its table's rules
+type validationError struct {
+	report *models.ValidationReport
+}
+
+func (e *validationError) Error() string {
+	if len(e.report.TableErrors) > 0 {
+		return fmt.Sprintf("validation failed: %s", strings.Join(e.report.TableErrors, "; "))
+	}
+	return fmt.Sprintf("validation failed: %d of %d rows are invalid", e.report.InvalidRows, e.report.TotalRows)
+}
+
+// schemaError is returned when a file's columns conflict with the table's schema policy
+type schemaError struct {
+	err error
+}
+
+func (e *schemaError) Error() string {
+	return e.err.Error()
+}
+
+// tableOptions holds the per-table settings supplied when a table is created
+type tableOptions struct {
+	Rules  *models.ValidationRules
+	Policy *models.SchemaPolicy
+}
+
+// applyRules checks csvData against rules and splits off the rows to quarantine.
+// A nil rule set accepts every row without producing a report.
+func applyRules(rules *models.ValidationRules, filename string, csvData *utils.CSVData, existing map[string]map[string]bool) (*utils.CSVData, []models.QuarantinedRow, *models.ValidationReport, error) {
+	if rules == nil {
+		return csvData, nil, nil, nil
+	}
+
+	result := utils.CheckRules(csvData, rules, existing)
+	result.Report.Filename = filename
+	if result.Rejected {
+		return nil, nil, result.Report, &validationError{report: result.Report}
+	}
+
+	if len(result.Violations) == 0 {
+		return csvData, nil, result.Report, nil
+	}
+
+	valid := &utils.CSVData{Headers: csvData.Headers}
+	var quarantined []models.QuarantinedRow
+	for i, row := range csvData.Rows {
+		violations, bad := result.Violations[i]
+		if !bad {
+			valid.Rows = append(valid.Rows, row)
+			continue
+		}
+
+		data := make(map[string]interface{}, len(csvData.Headers))
+		for j, col := range csvData.Headers {
+			if j < len(row) {
+				data[col.Name] = row[j]
+			} else {
+				data[col.Name] = nil
+			}
+		}
+		quarantined = append(quarantined, models.QuarantinedRow{
+			RowNumber: i + 2,
+			Filename:  filename,
+			Data:      data,
+			Errors:    violations,
+		})
+	}
+
+	return valid, quarantined, result.Report, nil
+}
+
+// storeValidation saves the latest validation report and quarantined rows of a table
+func storeValidation(db dbExecutor, tableID string, report *models.ValidationReport, quarantined []models.QuarantinedRow) error {
+	if report == nil {
+		return nil
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to serialize validation report: %v", err)
+	}
+
+	if _, err := db.Exec(`UPDATE data_tables SET validation_report = $1 WHERE id = $2`, reportJSON, tableID); err != nil {
+		return fmt.Errorf("failed to store validation report: %v", err)
+	}
+
+	for _, row := range quarantined {
+		dataJSON, err := json.Marshal(row.Data)
+		if err != nil {
+			return fmt.Errorf("failed to serialize quarantined row: %v", err)
+		}
+		errorsJSON, err := json.Marshal(row.Errors)
+		if err != nil {
+			return fmt.Errorf("failed to serialize quarantined row: %v", err)
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO quarantined_rows (table_id, row_number, filename, data, errors)
+			VALUES ($1, $2, $3, $4, $5)
+		`, tableID, row.RowNumber, row.Filename, dataJSON, errorsJSON)
+		if err != nil {
+			return fmt.Errorf("failed to quarantine row %d: %v", row.RowNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// loadTableRules returns the validation rules attached to a table, or nil
+func loadTableRules(db dbExecutor, tableID string) (*models.ValidationRules, error) {
+	var rulesJSON []byte
+	if err := db.QueryRow(`SELECT validation_rules FROM data_tables WHERE id = $1`, tableID).Scan(&rulesJSON); err != nil {
+		return nil, fmt.Errorf("failed to load validation rules: %v", err)
+	}
+
+	if rulesJSON == nil {
+		return nil, nil
+	}
+
+	var rules models.ValidationRules
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse validation rules: %v", err)
+	}
+
+	return &rules, nil
+}
+
+// uniqueValues returns the values already stored in the table for columns that must be unique
+func uniqueValues(db dbExecutor, tableRef string, rules *models.ValidationRules, tableSchema map[string]interface{}) (map[string]map[string]bool, error) {
+	existing := make(map[string]map[string]bool)
+	if rules == nil {
+		return existing, nil
+	}
+
+	for name, rule := range rules.Columns {
+		if _, ok := tableSchema[name]; !rule.Unique || !ok {
+			continue
+		}
+
+		rows, err := db.Query(fmt.Sprintf(`SELECT DISTINCT "%s"::text FROM %s WHERE "%s" IS NOT NULL`, name, tableRef, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing values of %s: %v", name, err)
+		}
+
+		values := make(map[string]bool)
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read existing values of %s: %v", name, err)
+			}
+			values[v] = true
+		}
+		rows.Close()
+		existing[name] = values
+	}
+
+	return existing, nil
+}
+
+// importCSV creates a new table in a workspace from parsed CSV data and stores its metadata
+func (h *Handlers) importCSV(userID, workspaceID, tableName, filename string, csvData *utils.CSVData, opts tableOptions) (*loadResult, error) {
+	loadData, quarantined, report, err := applyRules(opts.Rules, filename, csvData, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate physical table name, in the workspace's own schema when tenant schemas are on
+	schemaName, physicalTableName := utils.TableLocation(workspaceID, tableName)
+	tableRef := utils.QuoteTableName(schemaName, physicalTableName)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkQuota(tx, userID, workspaceID, 1, int64(len(loadData.Rows)), estimateBytes(loadData)); err != nil {
+		return nil, err
+	}
+
+	if schemaName != "" {
+		if err := ensureTenantSchema(tx, schemaName); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create dynamic table
+	if err := createDynamicTable(tx, tableRef, csvData.Headers); err != nil {
+		return nil, fmt.Errorf("failed to create table: %v", err)
+	}
+
+	// Insert data into dynamic table
+	rowsInserted, err := insertCSVData(tx, tableRef, loadData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert data: %v", err)
+	}
+
+	// Store table metadata
+	tableSchema := make(map[string]interface{})
+	for _, col := range csvData.Headers {
+		tableSchema[col.Name] = map[string]string{
+			"type":   col.DataType,
+			"sample": col.Sample,
+		}
+	}
+
+	schemaJSON, err := json.Marshal(tableSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize table schema: %v", err)
+	}
+
+	var rulesJSON []byte
+	if opts.Rules != nil {
+		if rulesJSON, err = json.Marshal(opts.Rules); err != nil {
+			return nil, fmt.Errorf("failed to serialize validation rules: %v", err)
+		}
+	}
+
+	policy := utils.DefaultSchemaPolicy()
+	if opts.Policy != nil {
+		policy = *opts.Policy
+	}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize schema policy: %v", err)
+	}
+
+	var tableID string
+	err = tx.QueryRow(`
+		INSERT INTO data_tables (user_id, organization_id, table_name, original_filename, column_count, row_count, table_schema, schema_name, physical_table_name, validation_rules, schema_policy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11)
+		RETURNING id
+	`, userID, workspaceID, tableName, filename, len(csvData.Headers), rowsInserted, schemaJSON, schemaName, physicalTableName, rulesJSON, policyJSON).Scan(&tableID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to store table metadata: %v", err)
+	}
+
+	if err := recordSchemaVersion(tx, tableID, 1, schemaJSON, nil, filename); err != nil {
+		return nil, err
+	}
+
+	if err := recordTableVersion(tx, tableID, 1, "create", filename, userID, nil); err != nil {
+		return nil, err
+	}
+
+	if err := storeValidation(tx, tableID, report, quarantined); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %v", err)
+	}
+
+	return &loadResult{
+		TableID:         tableID,
+		RowsImported:    rowsInserted,
+		RowsQuarantined: len(quarantined),
+		Report:          report,
+		Version:         1,
+	}, nil
+}
+
+// loadIntoTable appends to or replaces the rows of an existing table,
+// evolving its schema according to the table's schema policy
+func (h *Handlers) loadIntoTable(tableID, userID, filename string, csvData *utils.CSVData, mode string) (*loadResult, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the table first, so the schema, rules and unique values checked below are still
+	// true when the rows go in, even with other loads into the same table running
+	var schemaName, physicalTableName, ownerID, workspaceID string
+	var schemaJSON, policyJSON []byte
+	var schemaVersion, currentVersion int
+	var rowCount int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(schema_name, ''), physical_table_name, table_schema, schema_policy, schema_version,
+			COALESCE(user_id::text, ''), COALESCE(organization_id::text, ''), current_version, row_count
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, tableID).Scan(&schemaName, &physicalTableName, &schemaJSON, &policyJSON, &schemaVersion,
+		&ownerID, &workspaceID, &currentVersion, &rowCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load table metadata: %v", err)
+	}
+	tableRef := utils.QuoteTableName(schemaName, physicalTableName)
+
+	var tableSchema map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &tableSchema); err != nil {
+		return nil, fmt.Errorf("failed to parse table schema: %v", err)
+	}
+
+	policy := utils.DefaultSchemaPolicy()
+	if policyJSON != nil {
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			return nil, fmt.Errorf("failed to parse schema policy: %v", err)
+		}
+	}
+
+	plan, err := utils.PlanSchemaEvolution(schemaTypes(tableSchema), csvData, policy)
+	if err != nil {
+		return nil, &schemaError{err: err}
+	}
+
+	rules, err := loadTableRules(tx, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values being replaced don't count towards uniqueness
+	existing := map[string]map[string]bool{}
+	if mode != "replace" {
+		if existing, err = uniqueValues(tx, tableRef, rules, tableSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	loadData, quarantined, report, err := applyRules(rules, filename, plan.Data, existing)
+	if vErr, ok := err.(*validationError); ok {
+		// A rejected file leaves the rows as they were, but its report is kept like any other
+		if err := storeValidation(tx, tableID, vErr.report, nil); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit validation report: %v", err)
+		}
+		return nil, vErr
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The load is charged to the table's owner or workspace, whoever uploads it. The
+	// snapshot of the current contents takes as much space as the table does now.
+	addRows := int64(len(loadData.Rows))
+	if mode == "replace" {
+		addRows -= rowCount
+	}
+	var tableBytes int64
+	err = tx.QueryRow(`SELECT pg_total_relation_size($1::regclass)`, tableRef).Scan(&tableBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure table: %v", err)
+	}
+	if err := checkQuota(tx, ownerID, workspaceID, 0, addRows, estimateBytes(loadData)+tableBytes); err != nil {
+		return nil, err
+	}
+
+	// Freeze the current contents before they change
+	if err := snapshotVersion(tx, tableID, schemaName, physicalTableName, currentVersion); err != nil {
+		return nil, err
+	}
+
+	if len(plan.Changes) > 0 {
+		if err := evolveTable(tx, tableID, tableRef, tableSchema, plan, schemaVersion+1, filename); err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == "replace" {
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, tableRef)); err != nil {
+			return nil, fmt.Errorf("failed to clear table: %v", err)
+		}
+	}
+
+	rowsInserted, err := insertCSVData(tx, tableRef, loadData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert data: %v", err)
+	}
+
+	rowCountExpr := "row_count + $1"
+	if mode == "replace" {
+		rowCountExpr = "$1"
+	}
+	_, err = tx.Exec(fmt.Sprintf(`UPDATE data_tables SET row_count = %s WHERE id = $2`, rowCountExpr), rowsInserted, tableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update row count: %v", err)
+	}
+
+	if err := storeValidation(tx, tableID, report, quarantined); err != nil {
+		return nil, err
+	}
+
+	if err := recordTableVersion(tx, tableID, currentVersion+1, mode, filename, userID, nil); err != nil {
+		return nil, err
+	}
+
+	if err := pruneSnapshots(tx, tableID, schemaName); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit load: %v", err)
+	}
+
+	return &loadResult{
+		TableID:         tableID,
+		RowsImported:    rowsInserted,
+		RowsQuarantined: len(quarantined),
+		Report:          report,
+		SchemaChanges:   plan.Changes,
+		Version:         currentVersion + 1,
+	}, nil
+}
+
+// evolveTable applies a schema plan to the physical table and records a new schema version
+func evolveTable(db dbExecutor, tableID, tableRef string, tableSchema map[string]interface{}, plan *utils.SchemaPlan, version int, filename string) error {
+	for _, col := range plan.AddColumns {
+		_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s`, tableRef, col.Name, col.DataType))
+		if err != nil {
+			return fmt.Errorf("failed to add column %s: %v", col.Name, err)
+		}
+		tableSchema[col.Name] = map[string]string{
+			"type":   col.DataType,
+			"sample": col.Sample,
+		}
+	}
+
+	for _, col := range plan.WidenColumns {
+		_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" TYPE %s USING "%s"::%s`,
+			tableRef, col.Name, col.DataType, col.Name, col.DataType))
+		if err != nil {
+			return fmt.Errorf("failed to widen column %s: %v", col.Name, err)
+		}
+		if info, ok := tableSchema[col.Name].(map[string]interface{}); ok {
+			info["type"] = col.DataType
+		}
+	}
+
+	schemaJSON, err := json.Marshal(tableSchema)
+	if err != nil {
+		return fmt.Errorf("failed to serialize table schema: %v", err)
+	}
+
+	_, err = db.Exec(`
+		UPDATE data_tables
+		SET table_schema = $1, column_count = $2, schema_version = $3
+		WHERE id = $4
+	`, schemaJSON, len(tableSchema), version, tableID)
+	if err != nil {
+		return fmt.Errorf("failed to update table schema: %v", err)
+	}
+
+	return recordSchemaVersion(db, tableID, version, schemaJSON, plan.Changes, filename)
+}
+
+// recordSchemaVersion appends an entry to a table's schema history
+func recordSchemaVersion(db dbExecutor, tableID string, version int, schemaJSON []byte, changes []models.SchemaChange, filename string) error {
+	if changes == nil {
+		changes = []models.SchemaChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to serialize schema changes: %v", err)
+	}
+
+	var source interface{}
+	if filename != "" {
+		source = filename
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO schema_versions (table_id, version, table_schema, changes, filename)
+		VALUES ($1, $2, $3, $4, $5)
+	`, tableID, version, schemaJSON, changesJSON, source)
+	if err != nil {
+		return fmt.Errorf("failed to record schema version: %v", err)
+	}
+
+	return nil
+}
+
+// schemaTypes extracts the column types from a stored table schema
+func schemaTypes(tableSchema map[string]interface{}) map[string]string {
+	types := make(map[string]string, len(tableSchema))
+	for name, info := range tableSchema {
+		if m, ok := info.(map[string]interface{}); ok {
+			if t, ok := m["type"].(string); ok {
+				types[name] = t
+				continue
+			}
+		}
+		types[name] = "TEXT"
+	}
+	return types
+}
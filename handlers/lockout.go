@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"etl-api/middleware"
+	"etl-api/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginFailureKeys returns the counters a login attempt is tracked under. Counting by
+// email rather than user means unknown emails lock out exactly like real accounts.
+func loginFailureKeys(email, ip string) (string, string) {
+	return "email:" + strings.ToLower(email), "ip:" + ip
+}
+
+// beginLoginAttempt counts an attempt against the account and the client IP before the
+// password is checked, and returns how long the caller has to wait if it is refused. The
+// counting is one upsert that hands every attempt its own number, so parallel guesses
+// can't all get past the limit before their failures are recorded. Settle the attempt with
+// recordLoginFailure or endLoginAttempt once the password is checked.
+func (h *Handlers) beginLoginAttempt(email, ip string) (time.Duration, error) {
+	policy := utils.LoginPolicyFromEnv()
+	emailKey, ipKey := loginFailureKeys(email, ip)
+
+	// Counters start over once an account has been quiet for a whole lockout period
+	_, err := h.db.Exec(`
+		DELETE FROM login_failures
+		WHERE last_failure_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+	`, policy.LockoutDuration.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	// Held-back accounts and clients are refused without counting the attempt
+	var seconds float64
+	err = h.db.QueryRow(`
+		SELECT COALESCE(MAX(EXTRACT(EPOCH FROM locked_until - CURRENT_TIMESTAMP)), 0)
+		FROM login_failures
+		WHERE key IN ($1, $2) AND locked_until > CURRENT_TIMESTAMP
+	`, emailKey, ipKey).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	if seconds > 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	rows, err := h.db.Query(`
+		INSERT INTO login_failures (key, failures) VALUES ($1, 1), ($2, 1)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = login_failures.failures + 1, last_failure_at = CURRENT_TIMESTAMP
+		RETURNING key, failures
+	`, emailKey, ipKey)
+	if err != nil {
+		return 0, err
+	}
+	limits := map[string]int{emailKey: policy.MaxAccountFailures, ipKey: policy.MaxIPFailures}
+	var exceeded []string
+	for rows.Next() {
+		var key string
+		var attempts int
+		if err := rows.Scan(&key, &attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if attempts > limits[key] {
+			exceeded = append(exceeded, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Attempts past the limit lock the counter out, even if earlier ones haven't failed yet
+	for _, key := range exceeded {
+		if err := h.lockLoginFailures(key, policy.LockoutDuration); err != nil {
+			return 0, err
+		}
+	}
+	if len(exceeded) > 0 {
+		return policy.LockoutDuration, nil
+	}
+	return 0, nil
+}
+
+// lockLoginFailures holds back logins under the counter for delay, unless it is held back longer already
+func (h *Handlers) lockLoginFailures(key string, delay time.Duration) error {
+	_, err := h.db.Exec(`
+		UPDATE login_failures
+		SET locked_until = GREATEST(locked_until, CURRENT_TIMESTAMP + make_interval(secs => $1))
+		WHERE key = $2
+	`, delay.Seconds(), key)
+	return err
+}
+
+// recordLoginFailure settles an attempt whose password or code was wrong: the attempt is
+// already counted, so it holds back further attempts as the failures add up
+func (h *Handlers) recordLoginFailure(email, ip string) error {
+	policy := utils.LoginPolicyFromEnv()
+	emailKey, ipKey := loginFailureKeys(email, ip)
+
+	limits := map[string]int{emailKey: policy.MaxAccountFailures, ipKey: policy.MaxIPFailures}
+	for key, max := range limits {
+		var failures int
+		err := h.db.QueryRow(`SELECT failures FROM login_failures WHERE key = $1`, key).Scan(&failures)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if delay := policy.Delay(failures, max); delay > 0 {
+			if err := h.lockLoginFailures(key, delay); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// endLoginAttempt settles an attempt whose password or code was right, taking back the
+// failure it was counted as
+func (h *Handlers) endLoginAttempt(email, ip string) error {
+	emailKey, ipKey := loginFailureKeys(email, ip)
+	_, err := h.db.Exec(`
+		UPDATE login_failures SET failures = GREATEST(failures - 1, 0) WHERE key IN ($1, $2)
+	`, emailKey, ipKey)
+	return err
+}
+
+// clearLoginFailures resets the account's counter after a successful login. The IP
+// counter is left to expire, so logging into one account doesn't buy more guesses at others.
+func (h *Handlers) clearLoginFailures(email string) error {
+	emailKey, _ := loginFailureKeys(email, "")
+	_, err := h.db.Exec(`DELETE FROM login_failures WHERE key = $1`, emailKey)
+	return err
+}
+
+// writeTooManyAttempts refuses a login while the account or client IP is held back
+func writeTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, `{"error": "Too many failed login attempts; try again later"}`, http.StatusTooManyRequests)
+}
+
+// checkCurrentPassword confirms a logged-in user's password before a sensitive change.
+// Wrong guesses count like failed logins, so a stolen access token doesn't give unlimited
+// tries. It writes the error and returns false when the password isn't confirmed.
+func (h *Handlers) checkCurrentPassword(w http.ResponseWriter, r *http.Request, email, passwordHash, password string) bool {
+	clientIP := middleware.GetClientIP(r)
+	retryAfter, err := h.beginLoginAttempt(email, clientIP)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return false
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		if err := h.recordLoginFailure(email, clientIP); err != nil {
+			writeServerError(w, r, "Database error", err)
+			return false
+		}
+		http.Error(w, `{"error": "Current password is incorrect"}`, http.StatusForbidden)
+		return false
+	}
+	if err := h.endLoginAttempt(email, clientIP); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return false
+	}
+	return true
+}
+
+// UnlockUser clears a user's failed login count and lockout
+func (h *Handlers) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["id"]
+
+	var email string
+	err := h.db.QueryRow(`SELECT email FROM users WHERE id::text = $1`, targetID).Scan(&email)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if err := h.clearLoginFailures(email); err != nil {
+		writeServerError(w, r, "Failed to unlock user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
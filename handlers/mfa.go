@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"net/http"
+	"time"
+)
+
+const (
+	// mfaChallengeTTL is how long a user has to enter their code after the password
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeAttempts is how many wrong codes end a challenge
+	mfaChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes confirming MFA hands out
+	recoveryCodeCount = 10
+)
+
+// mfaEnabled reports whether the user has confirmed a TOTP authenticator
+func (h *Handlers) mfaEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NOT NULL)
+	`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// verifyMFACode checks a TOTP code or an unused recovery code for the user. A TOTP code
+// works once and recovery codes are used up, so the caller must commit tx on success.
+func verifyMFACode(tx *sql.Tx, userID, code string) (bool, error) {
+	var secret string
+	var lastStep sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT totp_secret, last_used_step FROM user_mfa
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL
+		FOR UPDATE
+	`, userID).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+		if lastStep.Valid && step <= lastStep.Int64 {
+			return false, nil
+		}
+		_, err := tx.Exec(`UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2`, step, userID)
+		return err == nil, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used == 1, err
+}
+
+// createMFAChallenge stores the half-finished login and returns the token that finishes it
+func (h *Handlers) createMFAChallenge(userID, workspaceID string) (string, error) {
+	token, err := utils.GenerateMFAToken()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := h.db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return "", err
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO mfa_challenges (token_hash, user_id, workspace_id, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+	`, utils.HashToken(token), userID, workspaceID, mfaChallengeTTL.Seconds())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// startMFAChallenge answers a login of a user with MFA on with a challenge instead of
+// tokens. It reports whether it answered the request.
+func (h *Handlers) startMFAChallenge(w http.ResponseWriter, r *http.Request, userID, workspaceID string) bool {
+	mfaEnabled, err := h.mfaEnabled(userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return true
+	}
+	if !mfaEnabled {
+		return false
+	}
+
+	mfaToken, err := h.createMFAChallenge(userID, workspaceID)
+	if err != nil {
+		writeServerError(w, r, "Failed to start MFA challenge", err)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int(mfaChallengeTTL.Seconds()),
+	})
+	return true
+}
+
+// GetMFAStatus reports whether MFA is on for the authenticated user
+func (h *Handlers) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var status models.MFAStatusResponse
+	err := h.db.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NOT NULL),
+			(SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+	`, userID).Scan(&status.Enabled, &status.RecoveryCodesLeft)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// EnrollMFA starts TOTP enrollment with a new secret. MFA only turns on once ConfirmMFA
+// receives a code from the authenticator app.
+func (h *Handlers) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		writeServerError(w, r, "Failed to generate secret", err)
+		return
+	}
+
+	// A pending enrollment is replaced, a confirmed one is left alone
+	result, err := h.db.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, last_used_step = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.confirmed_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		writeServerError(w, r, "Failed to start enrollment", err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "MFA is already enabled; disable it before enrolling again"}`, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.MFAEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(secret, middleware.GetUserEmailFromContext(r)),
+	})
+}
+
+// ConfirmMFA turns MFA on once the user proves their app generates valid codes, and
+// returns a fresh set of recovery codes
+func (h *Handlers) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var secret string
+	err = tx.QueryRow(`
+		SELECT totp_secret FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NULL FOR UPDATE
+	`, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "No pending enrollment; call POST /mfa/enroll first"}`, http.StatusConflict)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_mfa SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = $1 WHERE user_id = $2
+	`, step, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to enable MFA", err)
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeServerError(w, r, "Failed to generate recovery codes", err)
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		writeServerError(w, r, "Failed to enable MFA", err)
+		return
+	}
+	for _, code := range codes {
+		_, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+		if err != nil {
+			writeServerError(w, r, "Failed to enable MFA", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to enable MFA", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.MFARecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA turns MFA off; it takes a current code or a recovery code so a stolen
+// access token alone can't remove the second factor
+func (h *Handlers) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	valid, err := verifyMFACode(tx, userID, req.Code)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if !valid {
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		writeServerError(w, r, "Failed to disable MFA", err)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		writeServerError(w, r, "Failed to disable MFA", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to disable MFA", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginMFA finishes a login that returned an MFA challenge: it exchanges the challenge
+// token and a valid code for access and refresh tokens
+func (h *Handlers) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		http.Error(w, `{"error": "mfa_token and code are required"}`, http.StatusBadRequest)
+		return
+	}
+	tokenHash := utils.HashToken(req.MFAToken)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, email, workspaceID string
+	var attempts int
+	err = tx.QueryRow(`
+		SELECT c.user_id, u.email, c.workspace_id, c.attempts
+		FROM mfa_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1 AND c.expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE OF c
+	`, tokenHash).Scan(&userID, &email, &workspaceID, &attempts)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "MFA challenge is invalid or expired; log in again"}`, http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	middleware.SetAuditUser(r, userID, email)
+
+	// Wrong codes count against the account like wrong passwords, so a known password
+	// doesn't give unlimited challenges to guess codes with
+	clientIP := middleware.GetClientIP(r)
+	retryAfter, err := h.beginLoginAttempt(email, clientIP)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	valid, err := verifyMFACode(tx, userID, req.Code)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if !valid {
+		// Count the miss, and end the challenge once too many codes were wrong
+		if attempts+1 >= mfaChallengeAttempts {
+			_, err = tx.Exec(`DELETE FROM mfa_challenges WHERE token_hash = $1`, tokenHash)
+		} else {
+			_, err = tx.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1`, tokenHash)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		if err := h.recordLoginFailure(email, clientIP); err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.endLoginAttempt(email, clientIP); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// Each challenge finishes one login
+	if _, err := tx.Exec(`DELETE FROM mfa_challenges WHERE token_hash = $1`, tokenHash); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if err := h.clearLoginFailures(email); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	sessionID, refreshToken, err := h.createSession(userID, workspaceID)
+	if err != nil {
+		writeServerError(w, r, "Failed to create session", err)
+		return
+	}
+
+	h.writeAuthResponse(w, r, userID, email, workspaceID, sessionID, refreshToken)
+}
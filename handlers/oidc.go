@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"etl-api/middleware"
+	"etl-api/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errEmailMissing     = errors.New("identity provider returned no email")
+	errEmailNotVerified = errors.New("email not verified by identity provider")
+)
+
+// oidcStateTTL is how long a user has to finish signing in at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCLogin starts single sign-on by redirecting to the identity provider
+func (h *Handlers) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		http.Error(w, `{"error": "Single sign-on is not configured"}`, http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.NewOIDCState()
+	if err != nil {
+		writeServerError(w, r, "Failed to start sign-in", err)
+		return
+	}
+	nonce, err := utils.NewOIDCState()
+	if err != nil {
+		writeServerError(w, r, "Failed to start sign-in", err)
+		return
+	}
+	verifier, challenge, err := utils.NewPKCE()
+	if err != nil {
+		writeServerError(w, r, "Failed to start sign-in", err)
+		return
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		middleware.Logger(r).Error("Failed to reach identity provider", "error", err)
+		http.Error(w, `{"error": "Identity provider is unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	// Abandoned sign-ins leave their state behind; clear them out as new ones start
+	if _, err := h.db.Exec(`DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+	`, utils.HashToken(state), verifier, nonce, oidcStateTTL.Seconds())
+	if err != nil {
+		writeServerError(w, r, "Failed to start sign-in", err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback finishes single sign-on: it redeems the authorization code, validates the
+// ID token, finds or provisions the user and logs them in
+func (h *Handlers) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		http.Error(w, `{"error": "Single sign-on is not configured"}`, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		middleware.Logger(r).Warn("Identity provider returned an error", "error", errCode, "description", query.Get("error_description"))
+		http.Error(w, `{"error": "Sign-in was not completed at the identity provider"}`, http.StatusUnauthorized)
+		return
+	}
+
+	state := query.Get("state")
+	code := query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, `{"error": "state and code are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Each state can only finish one sign-in
+	var verifier, nonce string
+	err := h.db.QueryRow(`
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING code_verifier, nonce
+	`, utils.HashToken(state)).Scan(&verifier, &nonce)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Sign-in has expired or was already used; start again"}`, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	rawIDToken, err := h.oidc.Exchange(code, verifier)
+	if err != nil {
+		middleware.Logger(r).Warn("Failed to redeem authorization code", "error", err)
+		http.Error(w, `{"error": "Failed to redeem authorization code"}`, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.oidc.VerifyIDToken(rawIDToken, nonce)
+	if err != nil {
+		middleware.Logger(r).Warn("Invalid ID token", "error", err)
+		http.Error(w, `{"error": "Invalid ID token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	userID, email, err := h.oidcUser(claims)
+	if err == errEmailNotVerified {
+		http.Error(w, `{"error": "The identity provider has not verified this email address"}`, http.StatusForbidden)
+		return
+	} else if err == errEmailMissing {
+		http.Error(w, `{"error": "The identity provider did not share an email address"}`, http.StatusForbidden)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to sign in user", err)
+		return
+	}
+	middleware.SetAuditUser(r, userID, email)
+
+	workspaceID, err := h.resolveWorkspace(userID, "")
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Not a member of any workspace"}`, http.StatusForbidden)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// The identity provider's sign-in stands in for the password, not for the second factor
+	if h.startMFAChallenge(w, r, userID, workspaceID) {
+		return
+	}
+
+	sessionID, refreshToken, err := h.createSession(userID, workspaceID)
+	if err != nil {
+		writeServerError(w, r, "Failed to create session", err)
+		return
+	}
+
+	h.writeAuthResponse(w, r, userID, email, workspaceID, sessionID, refreshToken)
+}
+
+// oidcUser returns the user an ID token belongs to. Unknown identities are linked to the
+// user with the same email, or provisioned as a new user on their first sign-in.
+func (h *Handlers) oidcUser(claims *utils.IDTokenClaims) (string, string, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var userID, email string
+	err = tx.QueryRow(`
+		SELECT u.id, u.email FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`, claims.Issuer, claims.Subject).Scan(&userID, &email)
+	if err == nil {
+		return userID, email, nil
+	} else if err != sql.ErrNoRows {
+		return "", "", err
+	}
+
+	email = strings.TrimSpace(claims.Email)
+	if email == "" {
+		return "", "", errEmailMissing
+	}
+	// Linking by email hands over the account, so only trust addresses the provider says it
+	// verified; a provider that leaves email_verified out vouches for nothing
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		return "", "", errEmailNotVerified
+	}
+
+	err = tx.QueryRow(`
+		SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)
+		ORDER BY created_at
+		LIMIT 1
+	`, email).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		// Single sign-on users have no password, so password login never matches them
+		userID, _, err = createUser(tx, email, "")
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+	`, claims.Issuer, claims.Subject, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Password login may require a verified email; the provider has vouched for this one
+	_, err = tx.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return userID, email, nil
+}
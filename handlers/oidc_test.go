@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockClientID = "etl-api"
+
+// mockIdP is an OpenID Connect provider that signs in whoever asks, with the claims the
+// test gives it
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]mockAuthorization
+	issued int
+}
+
+// mockAuthorization is what the provider remembers about a code until it is redeemed
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mock",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// token redeems a code for an ID token, checking the PKCE verifier like a real provider
+func (p *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	auth, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge || r.FormValue("client_id") != mockClientID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   mockClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": auth.nonce,
+	}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// provider returns the OIDC configuration for signing in through the mock
+func (p *mockIdP) provider() *utils.OIDCProvider {
+	return &utils.OIDCProvider{
+		Issuer:      p.server.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://api.test/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+		Client:      p.server.Client(),
+	}
+}
+
+// authorize plays a user signing in at the provider: it takes the URL OIDCLogin redirected
+// to and returns the query the provider sends back to the callback
+func (p *mockIdP) authorize(t *testing.T, location string, claims jwt.MapClaims) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.server.URL+"/authorize?") {
+		t.Fatalf("OIDCLogin redirected to %q, not the provider", location)
+	}
+	query := u.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %q", location)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issued++
+	code := fmt.Sprintf("code-%d", p.issued)
+	p.codes[code] = mockAuthorization{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+
+	return url.Values{"state": {query.Get("state")}, "code": {code}}
+}
+
+// signInWithOIDC runs a whole single sign-on against the mock and returns the callback's response
+func signInWithOIDC(t *testing.T, h *Handlers, idp *mockIdP, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.OIDCLogin(rec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("OIDCLogin returned %d: %s", rec.Code, rec.Body)
+	}
+
+	query := idp.authorize(t, rec.Header().Get("Location"), claims)
+	rec = httptest.NewRecorder()
+	h.OIDCCallback(rec, httptest.NewRequest("GET", "/auth/oidc/callback?"+query.Encode(), nil))
+	return rec
+}
+
+func TestOIDCSignInProvisionsAndLinksUser(t *testing.T) {
+	db := openTestDB(t)
+	idp := newMockIdP(t)
+	h := &Handlers{db: db, oidc: idp.provider(), mailer: utils.LogMailer{}}
+
+	email := testEmail("oidc-new")
+	subject := "subject-" + email
+	claims := jwt.MapClaims{"sub": subject, "email": email, "email_verified": true}
+
+	rec := signInWithOIDC(t, h, idp, claims)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first sign-in returned %d: %s", rec.Code, rec.Body)
+	}
+	var auth models.AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&auth); err != nil || auth.Token == "" || auth.RefreshToken == "" {
+		t.Fatalf("first sign-in returned no tokens: %v", err)
+	}
+
+	// The second sign-in finds the user by the identity, not the email
+	claims["email"] = "renamed-" + email
+	if rec := signInWithOIDC(t, h, idp, claims); rec.Code != http.StatusOK {
+		t.Fatalf("second sign-in returned %d: %s", rec.Code, rec.Body)
+	}
+
+	var users int
+	var verified bool
+	err := db.QueryRow(`
+		SELECT COUNT(DISTINCT u.id), BOOL_AND(u.email_verified_at IS NOT NULL)
+		FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2 AND u.email = $3
+	`, idp.server.URL, subject, email).Scan(&users, &verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 || !verified {
+		t.Fatalf("expected one verified user linked to the identity, got %d (verified %v)", users, verified)
+	}
+}
+
+func TestOIDCSignInRequiresVerifiedEmailToLink(t *testing.T) {
+	db := openTestDB(t)
+	idp := newMockIdP(t)
+	h := &Handlers{db: db, oidc: idp.provider(), mailer: utils.LogMailer{}}
+
+	email := testEmail("oidc-existing")
+	if _, _, err := createUser(db, email, "$2a$10$not.a.real.hash"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, claims := range []jwt.MapClaims{
+		{"sub": "no-claim-" + email, "email": email},
+		{"sub": "unverified-" + email, "email": email, "email_verified": false},
+	} {
+		rec := signInWithOIDC(t, h, idp, claims)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("sign-in with %v returned %d, want 403", claims, rec.Code)
+		}
+	}
+
+	var linked int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM user_identities i JOIN users u ON u.id = i.user_id WHERE u.email = $1
+	`, email).Scan(&linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 0 {
+		t.Fatalf("unverified identities were linked to the existing account")
+	}
+}
+
+func TestOIDCSignInAsksForMFA(t *testing.T) {
+	db := openTestDB(t)
+	idp := newMockIdP(t)
+	h := &Handlers{db: db, oidc: idp.provider(), mailer: utils.LogMailer{}}
+
+	email := testEmail("oidc-mfa")
+	userID, _, err := createUser(db, email, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret, confirmed_at) VALUES ($1, 'JBSWY3DPEHPK3PXP', CURRENT_TIMESTAMP)
+	`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := signInWithOIDC(t, h, idp, jwt.MapClaims{"sub": "subject-" + email, "email": email, "email_verified": true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign-in returned %d: %s", rec.Code, rec.Body)
+	}
+	var challenge models.MFAChallengeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&challenge); err != nil || !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("expected an MFA challenge instead of tokens, got %v", err)
+	}
+}
+
+func TestOIDCCallbackRejectsReusedState(t *testing.T) {
+	db := openTestDB(t)
+	idp := newMockIdP(t)
+	h := &Handlers{db: db, oidc: idp.provider(), mailer: utils.LogMailer{}}
+
+	rec := httptest.NewRecorder()
+	h.OIDCLogin(rec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	email := testEmail("oidc-replay")
+	query := idp.authorize(t, rec.Header().Get("Location"), jwt.MapClaims{"sub": "subject-" + email, "email": email, "email_verified": true})
+
+	rec = httptest.NewRecorder()
+	h.OIDCCallback(rec, httptest.NewRequest("GET", "/auth/oidc/callback?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.OIDCCallback(rec, httptest.NewRequest("GET", "/auth/oidc/callback?"+query.Encode(), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("reused state returned %d, want 400", rec.Code)
+	}
+}
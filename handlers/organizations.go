@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var errWorkspaceNotFound = errors.New("workspace not found")
+
+// validOrganizationRole reports whether role is one of the organization roles
+func validOrganizationRole(role string) bool {
+	return role == "admin" || role == "member" || role == "read_only"
+}
+
+// createPersonalWorkspace creates the workspace every user starts in, with the user as admin
+func createPersonalWorkspace(db dbExecutor, userID, email string) (string, error) {
+	var workspaceID string
+	err := db.QueryRow(`
+		INSERT INTO organizations (name, personal, created_by) VALUES ($1, TRUE, $2)
+		RETURNING id
+	`, email, userID).Scan(&workspaceID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'admin')
+	`, workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if utils.TenantSchemasEnabled() {
+		if err := ensureTenantSchema(db, utils.TenantSchemaName(workspaceID)); err != nil {
+			return "", err
+		}
+	}
+
+	return workspaceID, nil
+}
+
+// ensureTenantSchema creates a workspace's Postgres schema if it doesn't exist yet
+func ensureTenantSchema(db dbExecutor, schemaName string) error {
+	if _, err := db.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schemaName)); err != nil {
+		return fmt.Errorf("failed to create schema %s: %v", schemaName, err)
+	}
+	return nil
+}
+
+// workspaceRole returns the user's role in a workspace, or errWorkspaceNotFound if they aren't a member
+func (h *Handlers) workspaceRole(workspaceID, userID string) (string, error) {
+	var role string
+	err := h.db.QueryRow(`
+		SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2
+	`, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", errWorkspaceNotFound
+	}
+	return role, err
+}
+
+// resolveWorkspace returns the requested workspace if the user belongs to it,
+// otherwise their personal workspace, falling back to the one they joined first
+func (h *Handlers) resolveWorkspace(userID, requested string) (string, error) {
+	if requested != "" {
+		if _, err := h.workspaceRole(requested, userID); err != nil {
+			return "", err
+		}
+		return requested, nil
+	}
+
+	var workspaceID string
+	err := h.db.QueryRow(`
+		SELECT m.organization_id
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY (o.personal AND o.created_by = $1) DESC, m.added_at
+		LIMIT 1
+	`, userID).Scan(&workspaceID)
+	if err == sql.ErrNoRows {
+		return "", errWorkspaceNotFound
+	}
+	return workspaceID, err
+}
+
+// requireWorkspaceWriter checks that the user may create tables in their current workspace
+func (h *Handlers) requireWorkspaceWriter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := middleware.GetUserIDFromContext(r)
+	workspaceID := middleware.GetWorkspaceIDFromContext(r)
+	if workspaceID == "" {
+		http.Error(w, `{"error": "No workspace selected; log in again"}`, http.StatusUnauthorized)
+		return "", false
+	}
+
+	role, err := h.workspaceRole(workspaceID, userID)
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "You are no longer a member of this workspace"}`, http.StatusForbidden)
+		return "", false
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return "", false
+	}
+	if role == "read_only" {
+		http.Error(w, `{"error": "Read-only members cannot create tables"}`, http.StatusForbidden)
+		return "", false
+	}
+
+	return workspaceID, true
+}
+
+// SwitchWorkspace issues a new token scoped to another workspace the user belongs to
+func (h *Handlers) SwitchWorkspace(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if !requireLogin(w, r) {
+		return
+	}
+
+	var req models.SwitchWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkspaceID == "" {
+		http.Error(w, `{"error": "workspace_id is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := h.resolveWorkspace(userID, req.WorkspaceID)
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Workspace not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// Later refreshes of this session stay in the new workspace
+	sessionID := middleware.GetSessionIDFromContext(r)
+	_, err = h.db.Exec(`UPDATE sessions SET workspace_id = $1 WHERE id = $2 AND user_id = $3`, workspaceID, sessionID, userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	h.writeAuthResponse(w, r, userID, middleware.GetUserEmailFromContext(r), workspaceID, sessionID, "")
+}
+
+// CreateOrganization creates an organization with the authenticated user as its admin
+func (h *Handlers) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		http.Error(w, `{"error": "Organization name is required and must be at most 255 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	org := models.Organization{Name: req.Name, Role: "admin"}
+	err = tx.QueryRow(`
+		INSERT INTO organizations (name, created_by) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, req.Name, userID).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		writeServerError(w, r, "Failed to create organization", err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'admin')
+	`, org.ID, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to add organization member", err)
+		return
+	}
+
+	if utils.TenantSchemasEnabled() {
+		if err := ensureTenantSchema(tx, utils.TenantSchemaName(org.ID)); err != nil {
+			writeServerError(w, r, "Failed to create organization schema", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit organization", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// ListOrganizations returns the organizations the authenticated user belongs to
+func (h *Handlers) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	currentID := middleware.GetWorkspaceIDFromContext(r)
+
+	rows, err := h.db.Query(`
+		SELECT o.id, o.name, o.personal, m.role, o.created_at
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.personal DESC, o.created_at
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve organizations", err)
+		return
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Personal, &org.Role, &org.CreatedAt); err != nil {
+			writeServerError(w, r, "Failed to scan organization", err)
+			return
+		}
+		org.Current = org.ID == currentID
+		orgs = append(orgs, org)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.OrganizationListResponse{
+		Organizations: orgs,
+		Total:         len(orgs),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListOrganizationMembers returns the members of an organization the user belongs to
+func (h *Handlers) ListOrganizationMembers(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	orgID := mux.Vars(r)["id"]
+
+	if _, err := h.workspaceRole(orgID, userID); err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Organization not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT m.user_id, u.email, m.role, m.added_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.added_at
+	`, orgID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve members", err)
+		return
+	}
+	defer rows.Close()
+
+	response := models.OrganizationMemberListResponse{
+		OrganizationID: orgID,
+		Members:        []models.OrganizationMember{},
+	}
+	for rows.Next() {
+		var member models.OrganizationMember
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Role, &member.AddedAt); err != nil {
+			writeServerError(w, r, "Failed to scan member", err)
+			return
+		}
+		response.Members = append(response.Members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// requireOrganizationAdmin writes an error unless the user is an admin of the organization
+func (h *Handlers) requireOrganizationAdmin(w http.ResponseWriter, r *http.Request, orgID, userID string) bool {
+	role, err := h.workspaceRole(orgID, userID)
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Organization not found"}`, http.StatusNotFound)
+		return false
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return false
+	}
+	if role != "admin" {
+		http.Error(w, `{"error": "Only organization admins can manage members"}`, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// AddOrganizationMember adds a registered user to an organization
+func (h *Handlers) AddOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	orgID := mux.Vars(r)["id"]
+
+	var req models.AddOrganizationMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Role == "" {
+		req.Role = "member"
+	}
+	if !validOrganizationRole(req.Role) {
+		http.Error(w, `{"error": "role must be admin, member or read_only"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !h.requireOrganizationAdmin(w, r, orgID, userID) {
+		return
+	}
+
+	var personal bool
+	if err := h.db.QueryRow(`SELECT personal FROM organizations WHERE id = $1`, orgID).Scan(&personal); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if personal {
+		http.Error(w, `{"error": "Personal workspaces can't have other members; create an organization instead"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The answer is the same whether or not the email has an account or is already a
+	// member, so organizations can't be used to find out who is registered
+	_, err := h.db.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		SELECT $1, id, $3 FROM users WHERE email = $2
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`, orgID, req.Email, req.Role)
+	if err != nil {
+		writeServerError(w, r, "Failed to add organization member", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	response := map[string]string{
+		"message":         "If the email belongs to a registered user, they are a member of the organization",
+		"organization_id": orgID,
+		"email":           req.Email,
+		"role":            req.Role,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateOrganizationMember changes a member's role
+func (h *Handlers) UpdateOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	orgID := vars["id"]
+	memberID := vars["user_id"]
+
+	var req models.UpdateOrganizationMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validOrganizationRole(req.Role) {
+		http.Error(w, `{"error": "role must be admin, member or read_only"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !h.requireOrganizationAdmin(w, r, orgID, userID) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Serialize membership changes so two admins can't demote each other at once
+	if _, err := tx.Exec(`SELECT id FROM organizations WHERE id = $1 FOR UPDATE`, orgID); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	var member models.OrganizationMember
+	err = tx.QueryRow(`
+		UPDATE organization_members m SET role = $1
+		FROM users u
+		WHERE u.id = m.user_id AND m.organization_id = $2 AND m.user_id = $3
+		RETURNING m.user_id, u.email, m.role, m.added_at
+	`, req.Role, orgID, memberID).Scan(&member.UserID, &member.Email, &member.Role, &member.AddedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Organization member not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to update organization member", err)
+		return
+	}
+
+	if !h.keepsAnAdmin(w, r, tx, orgID) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit organization member", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// RemoveOrganizationMember removes a user from an organization; members may remove themselves
+func (h *Handlers) RemoveOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	orgID := vars["id"]
+	memberID := vars["user_id"]
+
+	if memberID != userID && !h.requireOrganizationAdmin(w, r, orgID, userID) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM organizations WHERE id = $1 FOR UPDATE`, orgID); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2
+	`, orgID, memberID)
+	if err != nil {
+		writeServerError(w, r, "Failed to remove organization member", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Organization member not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if !h.keepsAnAdmin(w, r, tx, orgID) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit organization member removal", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":         "Organization member removed",
+		"organization_id": orgID,
+		"user_id":         memberID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// keepsAnAdmin writes an error if a membership change left the organization without an admin
+func (h *Handlers) keepsAnAdmin(w http.ResponseWriter, r *http.Request, tx *sql.Tx, orgID string) bool {
+	var admins int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = 'admin'
+	`, orgID).Scan(&admins)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return false
+	}
+	if admins == 0 {
+		http.Error(w, `{"error": "An organization must keep at least one admin"}`, http.StatusConflict)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const pipelineColumns = `id, user_id, organization_id, name, table_name, table_id, source_type, source, pattern,
+	schedule, load_mode, enabled, last_run_at, next_run_at, created_at`
+
+// scanPipeline scans a pipeline row selected with pipelineColumns
+func scanPipeline(row rowScanner) (models.Pipeline, error) {
+	var p models.Pipeline
+	err := row.Scan(&p.ID, &p.UserID, &p.OrganizationID, &p.Name, &p.TableName, &p.TableID, &p.SourceType, &p.Source,
+		&p.Pattern, &p.Schedule, &p.LoadMode, &p.Enabled, &p.LastRunAt, &p.NextRunAt, &p.CreatedAt)
+	return p, err
+}
+
+// CreatePipeline registers a scheduled pull from a directory or HTTP source
+func (h *Handlers) CreatePipeline(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreatePipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, `{"error": "name is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.ValidateTableName(req.TableName); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	switch req.SourceType {
+	case "directory":
+		if req.Pattern == "" {
+			req.Pattern = "*.csv"
+		}
+		if _, err := filepath.Match(req.Pattern, ""); err != nil {
+			http.Error(w, `{"error": "Invalid file pattern"}`, http.StatusBadRequest)
+			return
+		}
+		if _, err := utils.ResolveSourceDirectory(req.Source); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	case "http":
+		req.Pattern = ""
+		if _, err := utils.ValidateSourceURL(req.Source); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, `{"error": "source_type must be 'directory' or 'http'"}`, http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := utils.ParseCron(req.Schedule)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Invalid schedule: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// Schedules are evaluated in UTC. One on a date that doesn't exist, like February 30,
+	// would never run.
+	nextRun := schedule.Next(time.Now().UTC())
+	if nextRun.IsZero() {
+		http.Error(w, `{"error": "Invalid schedule: it never matches a date"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.LoadMode == "" {
+		req.LoadMode = "append"
+	}
+	if req.LoadMode != "append" && req.LoadMode != "replace" {
+		http.Error(w, `{"error": "load_mode must be 'append' or 'replace'"}`, http.StatusBadRequest)
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	// The pipeline creates its table in the current workspace
+	workspaceID, ok := h.requireWorkspaceWriter(w, r)
+	if !ok {
+		return
+	}
+
+	pipeline, err := scanPipeline(h.db.QueryRow(`
+		INSERT INTO pipelines (user_id, organization_id, name, table_name, source_type, source, pattern, schedule, load_mode, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+pipelineColumns,
+		userID, workspaceID, req.Name, req.TableName, req.SourceType, req.Source, req.Pattern, req.Schedule, req.LoadMode, enabled, nextRun))
+	if err != nil {
+		writeServerError(w, r, "Failed to create pipeline", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pipeline)
+}
+
+// ListPipelines returns all pipelines for the authenticated user
+func (h *Handlers) ListPipelines(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+pipelineColumns+`
+		FROM pipelines
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve pipelines", err)
+		return
+	}
+	defer rows.Close()
+
+	pipelines := []models.Pipeline{}
+	for rows.Next() {
+		pipeline, err := scanPipeline(rows)
+		if err != nil {
+			writeServerError(w, r, "Failed to scan pipeline data", err)
+			return
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.PipelineListResponse{
+		Pipelines: pipelines,
+		Total:     len(pipelines),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeletePipeline removes a pipeline and its run history
+func (h *Handlers) DeletePipeline(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	pipelineID := mux.Vars(r)["id"]
+
+	result, err := h.db.Exec(`DELETE FROM pipelines WHERE id = $1 AND user_id = $2`, pipelineID, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to delete pipeline", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Pipeline not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":     "Pipeline deleted successfully",
+		"pipeline_id": pipelineID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// TriggerPipeline runs a pipeline immediately, outside its schedule
+func (h *Handlers) TriggerPipeline(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	pipelineID := mux.Vars(r)["id"]
+
+	pipeline, err := scanPipeline(h.db.QueryRow(`SELECT `+pipelineColumns+` FROM pipelines WHERE id = $1 AND user_id = $2`, pipelineID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Pipeline not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	accessErr := h.checkPipelineAccess(&pipeline)
+	if _, ok := accessErr.(*pipelineAccessError); accessErr != nil && !ok {
+		writeServerError(w, r, "Database error", accessErr)
+		return
+	}
+
+	// Without access the run only records the failure and disables the pipeline
+	run, err := h.runPipeline(pipelineID, "manual")
+	if err != nil {
+		writeServerError(w, r, "Failed to run pipeline", err)
+		return
+	}
+	if accessErr != nil {
+		writeError(w, http.StatusForbidden, "You no longer have write access to this pipeline's table; the pipeline has been disabled", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// ListPipelineRuns returns the run history of a pipeline
+func (h *Handlers) ListPipelineRuns(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	pipelineID := mux.Vars(r)["id"]
+
+	rows, err := h.db.Query(`
+		SELECT pr.id, pr.pipeline_id, pr.trigger, pr.status, pr.files_ingested, pr.files_skipped,
+		       pr.rows_imported, pr.error_message, pr.started_at, pr.finished_at
+		FROM pipeline_runs pr
+		JOIN pipelines p ON p.id = pr.pipeline_id
+		WHERE pr.pipeline_id = $1 AND p.user_id = $2
+		ORDER BY pr.started_at DESC
+		LIMIT 100
+	`, pipelineID, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve pipeline runs", err)
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.PipelineRun{}
+	for rows.Next() {
+		var run models.PipelineRun
+		if err := rows.Scan(&run.ID, &run.PipelineID, &run.Trigger, &run.Status, &run.FilesIngested, &run.FilesSkipped,
+			&run.RowsImported, &run.ErrorMessage, &run.StartedAt, &run.FinishedAt); err != nil {
+			writeServerError(w, r, "Failed to scan pipeline run", err)
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.PipelineRunListResponse{
+		Runs:  runs,
+		Total: len(runs),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
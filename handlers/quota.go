@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+)
+
+// rowOverheadBytes approximates what Postgres stores per row on top of the values:
+// the tuple header, the id column and the row's index entry
+const rowOverheadBytes = 48
+
+// quotaError is returned when a load would take a user or workspace over its quota
+type quotaError struct {
+	resource string
+	used     int64
+	adding   int64
+	limit    int64
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d used, %d more needed, limit is %d", e.resource, e.used, e.adding, e.limit)
+}
+
+// writeQuotaError rejects a load over quota: 429 for too many tables, 413 for data that doesn't fit
+func writeQuotaError(w http.ResponseWriter, err *quotaError) {
+	status := http.StatusRequestEntityTooLarge
+	if err.resource == "tables" {
+		status = http.StatusTooManyRequests
+	}
+	http.Error(w, fmt.Sprintf(`{"error": "%s", "quota": "%s", "used": %d, "limit": %d}`,
+		err.Error(), err.resource, err.used, err.limit), status)
+}
+
+// quotaSubject returns the column and ID a quota adds tables up by: the owner or the workspace
+func quotaSubject(quota utils.Quota, userID, workspaceID string) (string, string) {
+	if quota.Scope == utils.QuotaScopeWorkspace {
+		return "organization_id", workspaceID
+	}
+	return "user_id", userID
+}
+
+// storageUsage adds up the tables, rows and bytes of every table whose column matches id.
+// Bytes include trashed tables and version snapshots, which take space too; tables and
+// rows only count live tables.
+func storageUsage(db dbExecutor, column, id string) (tables, rows, bytes int64, err error) {
+	err = db.QueryRow(fmt.Sprintf(`
+		SELECT
+			COUNT(*) FILTER (WHERE d.deleted_at IS NULL),
+			COALESCE(SUM(d.row_count) FILTER (WHERE d.deleted_at IS NULL), 0),
+			COALESCE(SUM(
+				COALESCE(pg_total_relation_size(to_regclass(format('%%I.%%I', COALESCE(d.schema_name, 'public'),
+					CASE WHEN d.deleted_at IS NULL THEN d.physical_table_name ELSE d.trash_table_name END))), 0)
+				+ (SELECT COALESCE(SUM(pg_total_relation_size(to_regclass(format('%%I.%%I', COALESCE(d.schema_name, 'public'), v.snapshot_table_name)))), 0)
+					FROM table_versions v WHERE v.table_id = d.id AND v.snapshot_table_name IS NOT NULL)
+			), 0)
+		FROM data_tables d
+		WHERE d.%s::text = $1
+	`, column), id).Scan(&tables, &rows, &bytes)
+	return tables, rows, bytes, err
+}
+
+// checkQuota fails with a quotaError if adding the tables, rows and bytes would take the
+// table owner, or the workspace, over its quota. Call it in the transaction that adds them:
+// it holds the quota until the transaction ends, so concurrent loads are checked one after
+// the other instead of all passing against the same usage. Lock the table's data_tables
+// row, if any, before calling it.
+func checkQuota(tx dbExecutor, userID, workspaceID string, tables, rows, bytes int64) error {
+	quota := utils.QuotaFromEnv()
+	if !quota.Enabled() {
+		return nil
+	}
+
+	column, id := quotaSubject(quota, userID, workspaceID)
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "quota:"+column+":"+id); err != nil {
+		return fmt.Errorf("failed to lock quota: %v", err)
+	}
+	usedTables, usedRows, usedBytes, err := storageUsage(tx, column, id)
+	if err != nil {
+		return fmt.Errorf("failed to check quota: %v", err)
+	}
+
+	if quota.MaxTables > 0 && tables > 0 && usedTables+tables > quota.MaxTables {
+		return &quotaError{resource: "tables", used: usedTables, adding: tables, limit: quota.MaxTables}
+	}
+	if quota.MaxRows > 0 && rows > 0 && usedRows+rows > quota.MaxRows {
+		return &quotaError{resource: "rows", used: usedRows, adding: rows, limit: quota.MaxRows}
+	}
+	if quota.MaxBytes > 0 && bytes > 0 && usedBytes+bytes > quota.MaxBytes {
+		return &quotaError{resource: "bytes", used: usedBytes, adding: bytes, limit: quota.MaxBytes}
+	}
+	return nil
+}
+
+// estimateRowBytes approximates the storage one row of values takes once inserted
+func estimateRowBytes(values []interface{}) int64 {
+	total := int64(rowOverheadBytes)
+	for _, value := range values {
+		if value != nil {
+			total += int64(len(fmt.Sprint(value)))
+		}
+	}
+	return total
+}
+
+// estimateBytes approximates the storage CSV data takes once loaded
+func estimateBytes(csvData *utils.CSVData) int64 {
+	total := int64(0)
+	for _, row := range csvData.Rows {
+		total += rowOverheadBytes
+		for _, value := range row {
+			total += int64(len(value))
+		}
+	}
+	return total
+}
+
+// GetUsage reports the storage the user, or their current workspace, uses against its quota
+func (h *Handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	quota := utils.QuotaFromEnv()
+	usage := models.Usage{Scope: quota.Scope}
+	if quota.Scope == utils.QuotaScopeWorkspace {
+		usage.WorkspaceID = middleware.GetWorkspaceIDFromContext(r)
+		if usage.WorkspaceID == "" {
+			http.Error(w, `{"error": "No workspace selected; log in again"}`, http.StatusUnauthorized)
+			return
+		}
+		if _, err := h.workspaceRole(usage.WorkspaceID, userID); err == errWorkspaceNotFound {
+			http.Error(w, `{"error": "You are no longer a member of this workspace"}`, http.StatusForbidden)
+			return
+		} else if err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+	}
+
+	column, id := quotaSubject(quota, userID, usage.WorkspaceID)
+	var err error
+	usage.Tables, usage.Rows, usage.Bytes, err = storageUsage(h.db, column, id)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if quota.MaxTables > 0 {
+		usage.Limits.Tables = &quota.MaxTables
+	}
+	if quota.MaxRows > 0 {
+		usage.Limits.Rows = &quota.MaxRows
+	}
+	if quota.MaxBytes > 0 {
+		usage.Limits.Bytes = &quota.MaxBytes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
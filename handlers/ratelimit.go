@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"etl-api/middleware"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// rateLimitSweepChance is the odds, one in this many, that a take also deletes idle buckets
+const rateLimitSweepChance = 1000
+
+// TakeRateLimit takes a token from a bucket kept in Postgres, so every instance of the
+// server shares the same budgets. Time comes from the database clock for the same reason.
+func (h *Handlers) TakeRateLimit(key string, limit middleware.RateLimit) (middleware.RateLimitResult, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return middleware.RateLimitResult{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO rate_limit_buckets (key, tokens) VALUES ($1, $2)
+		ON CONFLICT (key) DO NOTHING
+	`, key, limit.Requests)
+	if err != nil {
+		return middleware.RateLimitResult{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRow(`
+		SELECT tokens, EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - updated_at)
+		FROM rate_limit_buckets WHERE key = $1
+		FOR UPDATE
+	`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return middleware.RateLimitResult{}, err
+	}
+
+	tokens, result := limit.Spend(limit.Refill(tokens, time.Duration(elapsed*float64(time.Second))))
+	_, err = tx.Exec(`
+		UPDATE rate_limit_buckets SET tokens = $1, updated_at = CURRENT_TIMESTAMP WHERE key = $2
+	`, tokens, key)
+	if err != nil {
+		return middleware.RateLimitResult{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return middleware.RateLimitResult{}, err
+	}
+
+	// Buckets idle for a day have long refilled, so deleting them changes nothing
+	if rand.Intn(rateLimitSweepChance) == 0 {
+		if _, err := h.db.Exec(`
+			DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - INTERVAL '1 day'
+		`); err != nil {
+			slog.Error("Failed to delete idle rate limit buckets", "error", err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// roleScopes lists the scopes each user role grants
+var roleScopes = map[string][]string{
+	"admin":  {middleware.ScopeAdmin, middleware.ScopeDelete, middleware.ScopeRead, middleware.ScopeUpload, middleware.ScopeWrite},
+	"editor": {middleware.ScopeDelete, middleware.ScopeRead, middleware.ScopeUpload, middleware.ScopeWrite},
+	"viewer": {middleware.ScopeRead},
+}
+
+// intersectScopes returns the scopes present in both lists
+func intersectScopes(a, b []string) []string {
+	allowed := make(map[string]bool, len(b))
+	for _, scope := range b {
+		allowed[scope] = true
+	}
+	scopes := []string{}
+	for _, scope := range a {
+		if allowed[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// userAccess returns a user's role and the scopes it grants, narrowed to the user's own scope list if set
+func (h *Handlers) userAccess(userID string) (string, []string, error) {
+	var role string
+	var scopesJSON []byte
+	err := h.db.QueryRow(`SELECT role, scopes FROM users WHERE id = $1`, userID).Scan(&role, &scopesJSON)
+	if err != nil {
+		return "", nil, err
+	}
+
+	scopes := roleScopes[role]
+	if scopesJSON != nil {
+		var limit []string
+		if err := json.Unmarshal(scopesJSON, &limit); err != nil {
+			return "", nil, fmt.Errorf("failed to parse scopes: %v", err)
+		}
+		scopes = intersectScopes(scopes, limit)
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return role, scopes, nil
+}
+
+// scanUser reads a user selected as id, email, role, scopes, created_at, updated_at
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var scopesJSON []byte
+	err := row.Scan(&user.ID, &user.Email, &user.Role, &scopesJSON, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if scopesJSON != nil {
+		if err := json.Unmarshal(scopesJSON, &user.Scopes); err != nil {
+			return nil, fmt.Errorf("failed to parse scopes: %v", err)
+		}
+	}
+	return &user, nil
+}
+
+// ListUsers returns every user with their role and scopes
+func (h *Handlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT id, email, role, scopes, created_at, updated_at
+		FROM users
+		ORDER BY created_at
+	`)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve users", err)
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			writeServerError(w, r, "Failed to scan user", err)
+			return
+		}
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.UserListResponse{
+		Users: users,
+		Total: len(users),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateUserAccess changes a user's role and scopes. New access tokens pick up the
+// change; tokens already issued keep their scopes until they expire.
+func (h *Handlers) UpdateUserAccess(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["id"]
+
+	var req models.UpdateUserAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := roleScopes[req.Role]; !ok {
+		http.Error(w, `{"error": "role must be admin, editor or viewer"}`, http.StatusBadRequest)
+		return
+	}
+
+	var scopesJSON interface{}
+	if req.Scopes != nil {
+		scopes := []string{}
+		seen := make(map[string]bool)
+		for _, scope := range *req.Scopes {
+			if !middleware.ValidScope(scope) {
+				writeError(w, http.StatusBadRequest, "Unknown scope "+scope, "")
+				return
+			}
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+		sort.Strings(scopes)
+		encoded, _ := json.Marshal(scopes)
+		scopesJSON = encoded
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the user and every admin so two admins can't demote or delete each other at once
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 OR role = 'admin' FOR UPDATE`, targetID); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	user, err := scanUser(tx.QueryRow(`
+		UPDATE users SET role = $1, scopes = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING id, email, role, scopes, created_at, updated_at
+	`, req.Role, scopesJSON, targetID))
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to update user", err)
+		return
+	}
+
+	var admins int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM users
+		WHERE role = 'admin' AND (scopes IS NULL OR scopes ? 'admin')
+	`).Scan(&admins)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if admins == 0 {
+		http.Error(w, `{"error": "At least one user must keep admin access"}`, http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to update user", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
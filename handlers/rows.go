@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// loadRowTable returns the quoted table reference and column types of a table the user can edit
+func (h *Handlers) loadRowTable(tableID, userID string) (string, map[string]string, error) {
+	if err := h.authorizeTable(tableID, userID, permEditor); err != nil {
+		return "", nil, err
+	}
+
+	var schemaName, physicalTableName string
+	var schemaJSON []byte
+	err := h.db.QueryRow(`
+		SELECT COALESCE(schema_name, ''), physical_table_name, table_schema
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tableID).Scan(&schemaName, &physicalTableName, &schemaJSON)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var tableSchema map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &tableSchema); err != nil {
+		return "", nil, fmt.Errorf("failed to parse table schema: %v", err)
+	}
+
+	return utils.QuoteTableName(schemaName, physicalTableName), schemaTypes(tableSchema), nil
+}
+
+// decodeRowValues reads a JSON object of column values and type-checks it against the schema
+func decodeRowValues(r *http.Request, types map[string]string) ([]string, []interface{}, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON payload")
+	}
+
+	columns := make([]string, 0, len(body))
+	for name := range body {
+		if _, ok := types[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown column %s", name)
+		}
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, name := range columns {
+		v, err := utils.CoerceValue(types[name], body[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %s: %v", name, err)
+		}
+		values[i] = v
+	}
+
+	return columns, values, nil
+}
+
+// parseRowID reads the row_id path variable
+func parseRowID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(mux.Vars(r)["row_id"], 10, 64)
+}
+
+// fetchRow reads a single row by id with all schema columns
+func fetchRow(db dbExecutor, tableRef string, types map[string]string, rowID int64) (map[string]interface{}, error) {
+	columns := make([]string, 0, len(types))
+	for name := range types {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+
+	quotedColumns := make([]string, len(columns))
+	for i, col := range columns {
+		quotedColumns[i] = fmt.Sprintf(`"%s"`, col)
+	}
+
+	query := fmt.Sprintf(`SELECT id, %s FROM %s WHERE id = $1`, strings.Join(quotedColumns, ", "), tableRef)
+	if len(columns) == 0 {
+		query = fmt.Sprintf(`SELECT id FROM %s WHERE id = $1`, tableRef)
+	}
+
+	values := make([]interface{}, len(columns)+1)
+	valuePtrs := make([]interface{}, len(values))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	if err := db.QueryRow(query, rowID).Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	// The id is returned beside the row, like row_ids for table reads
+	row := make(map[string]interface{})
+	for i, column := range columns {
+		if b, ok := values[i+1].([]byte); ok {
+			row[column] = string(b)
+		} else {
+			row[column] = values[i+1]
+		}
+	}
+
+	return row, nil
+}
+
+// CreateRow inserts a single row into an uploaded table
+func (h *Handlers) CreateRow(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["table_id"]
+
+	tableRef, types, err := h.loadRowTable(tableID, userID)
+	if err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	columns, values, err := decodeRowValues(r, types)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s DEFAULT VALUES RETURNING id`, tableRef)
+	if len(columns) > 0 {
+		quotedColumns := make([]string, len(columns))
+		placeholders := make([]string, len(columns))
+		for i, col := range columns {
+			quotedColumns[i] = fmt.Sprintf(`"%s"`, col)
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		query = fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) RETURNING id`,
+			tableRef, strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "))
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// The row counts towards the quota of the table's owner or workspace
+	var ownerID, workspaceID string
+	err = tx.QueryRow(`
+		SELECT COALESCE(user_id::text, ''), COALESCE(organization_id::text, '')
+		FROM data_tables WHERE id = $1
+		FOR UPDATE
+	`, tableID).Scan(&ownerID, &workspaceID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if err := checkQuota(tx, ownerID, workspaceID, 0, 1, estimateRowBytes(values)); err != nil {
+		if qErr, ok := err.(*quotaError); ok {
+			writeQuotaError(w, qErr)
+			return
+		}
+		writeServerError(w, r, "Failed to check quota", err)
+		return
+	}
+
+	var rowID int64
+	if err := tx.QueryRow(query, values...).Scan(&rowID); err != nil {
+		if pqErr, ok := invalidValueError(err); ok {
+			writeError(w, http.StatusBadRequest, "Failed to insert row", pqErr.Message)
+			return
+		}
+		writeServerError(w, r, "Failed to insert row", err)
+		return
+	}
+
+	var rowCount int
+	err = tx.QueryRow(`
+		UPDATE data_tables SET row_count = row_count + 1
+		WHERE id = $1
+		RETURNING row_count
+	`, tableID).Scan(&rowCount)
+	if err != nil {
+		writeServerError(w, r, "Failed to update row count", err)
+		return
+	}
+
+	row, err := fetchRow(tx, tableRef, types, rowID)
+	if err != nil {
+		writeServerError(w, r, "Failed to read inserted row", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit row", err)
+		return
+	}
+
+	response := models.RowResponse{
+		TableID:  tableID,
+		RowID:    rowID,
+		Row:      row,
+		RowCount: rowCount,
+		Message:  "Row created successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateRow changes selected columns of a single row
+func (h *Handlers) UpdateRow(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["table_id"]
+	rowID, err := parseRowID(r)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid row ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	tableRef, types, err := h.loadRowTable(tableID, userID)
+	if err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	columns, values, err := decodeRowValues(r, types)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if len(columns) == 0 {
+		http.Error(w, `{"error": "No columns to update"}`, http.StatusBadRequest)
+		return
+	}
+
+	assignments := make([]string, len(columns))
+	for i, col := range columns {
+		assignments[i] = fmt.Sprintf(`"%s" = $%d`, col, i+1)
+	}
+	query := fmt.Sprintf(`UPDATE %s SET %s WHERE id = $%d`,
+		tableRef, strings.Join(assignments, ", "), len(columns)+1)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the row so the row returned is the one this update wrote
+	var lockedID int64
+	err = tx.QueryRow(fmt.Sprintf(`SELECT id FROM %s WHERE id = $1 FOR UPDATE`, tableRef), rowID).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Row not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if _, err := tx.Exec(query, append(values, rowID)...); err != nil {
+		if pqErr, ok := invalidValueError(err); ok {
+			writeError(w, http.StatusBadRequest, "Failed to update row", pqErr.Message)
+			return
+		}
+		writeServerError(w, r, "Failed to update row", err)
+		return
+	}
+
+	row, err := fetchRow(tx, tableRef, types, rowID)
+	if err != nil {
+		writeServerError(w, r, "Failed to read updated row", err)
+		return
+	}
+
+	var rowCount int
+	if err := tx.QueryRow(`SELECT row_count FROM data_tables WHERE id = $1`, tableID).Scan(&rowCount); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit row", err)
+		return
+	}
+
+	response := models.RowResponse{
+		TableID:  tableID,
+		RowID:    rowID,
+		Row:      row,
+		RowCount: rowCount,
+		Message:  "Row updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteRow removes a single row from an uploaded table
+func (h *Handlers) DeleteRow(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["table_id"]
+	rowID, err := parseRowID(r)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid row ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	tableRef, _, err := h.loadRowTable(tableID, userID)
+	if err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, tableRef), rowID)
+	if err != nil {
+		writeServerError(w, r, "Failed to delete row", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Row not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var rowCount int
+	err = tx.QueryRow(`
+		UPDATE data_tables SET row_count = GREATEST(row_count - 1, 0)
+		WHERE id = $1
+		RETURNING row_count
+	`, tableID).Scan(&rowCount)
+	if err != nil {
+		writeServerError(w, r, "Failed to update row count", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit row deletion", err)
+		return
+	}
+
+	response := models.RowResponse{
+		TableID:  tableID,
+		RowID:    rowID,
+		RowCount: rowCount,
+		Message:  "Row deleted successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
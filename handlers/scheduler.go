@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StartScheduler checks for due pipelines every interval in the background
+func (h *Handlers) StartScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			h.runDuePipelines()
+		}
+	}()
+}
+
+// runDuePipelines claims and runs every enabled pipeline whose next run has passed
+func (h *Handlers) runDuePipelines() {
+	now := time.Now().UTC()
+
+	rows, err := h.db.Query(`
+		SELECT id, schedule, next_run_at
+		FROM pipelines
+		WHERE enabled AND next_run_at <= $1
+	`, now)
+	if err != nil {
+		slog.Error("Failed to query due pipelines", "error", err)
+		return
+	}
+
+	type duePipeline struct {
+		id       string
+		schedule string
+		due      time.Time
+	}
+	var due []duePipeline
+	for rows.Next() {
+		var p duePipeline
+		if err := rows.Scan(&p.id, &p.schedule, &p.due); err != nil {
+			slog.Error("Failed to scan pipeline", "error", err)
+			continue
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+
+	for _, p := range due {
+		schedule, err := utils.ParseCron(p.schedule)
+		if err != nil {
+			slog.Error("Pipeline has an invalid schedule", "error", err, "pipeline_id", p.id)
+			continue
+		}
+
+		// A schedule with no next run would stay due forever, so turn the pipeline off instead
+		next := schedule.Next(now)
+		if next.IsZero() {
+			slog.Warn("Disabling pipeline whose schedule never runs again", "pipeline_id", p.id, "schedule", p.schedule)
+			if _, err := h.db.Exec(`
+				UPDATE pipelines SET enabled = FALSE WHERE id = $1 AND next_run_at = $2
+			`, p.id, p.due); err != nil {
+				slog.Error("Failed to disable pipeline", "error", err, "pipeline_id", p.id)
+			}
+			continue
+		}
+
+		// Advance next_run_at conditionally so only one instance runs the pipeline
+		result, err := h.db.Exec(`
+			UPDATE pipelines SET next_run_at = $1
+			WHERE id = $2 AND next_run_at = $3
+		`, next, p.id, p.due)
+		if err != nil {
+			slog.Error("Failed to claim pipeline", "error", err, "pipeline_id", p.id)
+			continue
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		if _, err := h.runPipeline(p.id, "schedule"); err != nil {
+			slog.Error("Pipeline run failed", "error", err, "pipeline_id", p.id)
+		}
+	}
+}
+
+// pipelineAccessError is returned when a pipeline's creator may no longer write its table
+type pipelineAccessError struct {
+	reason string
+}
+
+func (e *pipelineAccessError) Error() string {
+	return "pipeline disabled: " + e.reason
+}
+
+// checkPipelineAccess checks that the pipeline's creator can still write to its table,
+// or create it in the pipeline's workspace before the first load. Memberships and shares
+// change after a pipeline is set up, so every run checks again.
+func (h *Handlers) checkPipelineAccess(pipeline *models.Pipeline) error {
+	if pipeline.TableID != nil {
+		err := h.authorizeTable(*pipeline.TableID, pipeline.UserID, permEditor)
+		if err == errTableNotFound || err == errForbidden {
+			return &pipelineAccessError{reason: "its creator can no longer write to the table"}
+		}
+		return err
+	}
+
+	role, err := h.workspaceRole(pipeline.OrganizationID, pipeline.UserID)
+	if err == errWorkspaceNotFound || (err == nil && role == "read_only") {
+		return &pipelineAccessError{reason: "its creator can no longer create tables in the workspace"}
+	}
+	return err
+}
+
+// runPipeline fetches the pipeline's source and loads every file not seen before
+func (h *Handlers) runPipeline(pipelineID, trigger string) (*models.PipelineRun, error) {
+	pipeline, err := scanPipeline(h.db.QueryRow(`SELECT `+pipelineColumns+` FROM pipelines WHERE id = $1`, pipelineID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pipeline: %v", err)
+	}
+
+	run := &models.PipelineRun{
+		PipelineID: pipelineID,
+		Trigger:    trigger,
+		Status:     "running",
+	}
+	err = h.db.QueryRow(`
+		INSERT INTO pipeline_runs (pipeline_id, trigger, status)
+		VALUES ($1, $2, $3)
+		RETURNING id, started_at
+	`, pipelineID, trigger, run.Status).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record pipeline run: %v", err)
+	}
+
+	runErr := h.checkPipelineAccess(&pipeline)
+	if _, ok := runErr.(*pipelineAccessError); ok {
+		// Stop the schedule; the failed run records why
+		slog.Warn("Disabling pipeline whose creator lost access", "pipeline_id", pipelineID, "reason", runErr)
+		if _, err := h.db.Exec(`UPDATE pipelines SET enabled = FALSE WHERE id = $1`, pipelineID); err != nil {
+			slog.Error("Failed to disable pipeline", "error", err, "pipeline_id", pipelineID)
+		}
+	} else if runErr == nil {
+		runErr = h.ingestPipelineSource(&pipeline, run)
+	}
+
+	run.Status = "success"
+	if runErr != nil {
+		run.Status = "failed"
+		message := runErr.Error()
+		run.ErrorMessage = &message
+	}
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+
+	_, err = h.db.Exec(`
+		UPDATE pipeline_runs
+		SET status = $1, files_ingested = $2, files_skipped = $3, rows_imported = $4, error_message = $5, finished_at = $6
+		WHERE id = $7
+	`, run.Status, run.FilesIngested, run.FilesSkipped, run.RowsImported, run.ErrorMessage, finishedAt, run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pipeline run: %v", err)
+	}
+
+	_, err = h.db.Exec(`UPDATE pipelines SET last_run_at = $1 WHERE id = $2`, finishedAt, pipelineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pipeline: %v", err)
+	}
+
+	return run, nil
+}
+
+// ingestPipelineSource loads new files from the pipeline source, updating run counters
+func (h *Handlers) ingestPipelineSource(pipeline *models.Pipeline, run *models.PipelineRun) error {
+	var files []utils.SourceFile
+	switch pipeline.SourceType {
+	case "directory":
+		dirFiles, err := utils.ReadDirectorySource(pipeline.Source, pipeline.Pattern, getMaxFileSize())
+		if err != nil {
+			return err
+		}
+		files = dirFiles
+	case "http":
+		file, err := utils.FetchHTTPSource(pipeline.Source, getMaxFileSize())
+		if err != nil {
+			return err
+		}
+		files = append(files, *file)
+	default:
+		return fmt.Errorf("unknown source type %q", pipeline.SourceType)
+	}
+
+	for _, file := range files {
+		// Claim the content hash first so concurrent runs never load a file twice
+		var claimID string
+		err := h.db.QueryRow(`
+			INSERT INTO ingested_files (pipeline_id, run_id, filename, content_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (pipeline_id, content_hash) DO NOTHING
+			RETURNING id
+		`, pipeline.ID, run.ID, file.Name, file.Hash).Scan(&claimID)
+		if err == sql.ErrNoRows {
+			// No row returned means this content was already ingested
+			run.FilesSkipped++
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to record ingested file: %v", err)
+		}
+
+		rows, err := h.ingestPipelineFile(pipeline, file)
+		if err != nil {
+			// Release the claim so the next run retries the file; a claim left behind
+			// makes every later run skip it as already ingested
+			if _, releaseErr := h.db.Exec(`DELETE FROM ingested_files WHERE id = $1`, claimID); releaseErr != nil {
+				slog.Error("Failed to release claim on a file that failed to load; it will be skipped until the claim is deleted",
+					"error", releaseErr, "pipeline_id", pipeline.ID, "file", file.Name, "content_hash", file.Hash)
+			}
+			return fmt.Errorf("%s: %v", file.Name, err)
+		}
+
+		if _, err := h.db.Exec(`UPDATE ingested_files SET rows_imported = $1 WHERE id = $2`, rows, claimID); err != nil {
+			slog.Error("Failed to record rows imported from file", "error", err, "pipeline_id", pipeline.ID, "file", file.Name)
+		}
+		run.FilesIngested++
+		run.RowsImported += rows
+	}
+
+	return nil
+}
+
+// ingestPipelineFile creates the pipeline's table on first load and appends or replaces afterwards
+func (h *Handlers) ingestPipelineFile(pipeline *models.Pipeline, file utils.SourceFile) (int, error) {
+	csvData, err := utils.ParseCSV(bytes.NewReader(file.Content))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+
+	if pipeline.TableID != nil {
+		result, err := h.loadIntoTable(*pipeline.TableID, pipeline.UserID, file.Name, csvData, pipeline.LoadMode)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsImported, nil
+	}
+
+	result, err := h.importCSV(pipeline.UserID, pipeline.OrganizationID, pipeline.TableName, file.Name, csvData, tableOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := h.db.Exec(`UPDATE pipelines SET table_id = $1 WHERE id = $2`, result.TableID, pipeline.ID); err != nil {
+		return 0, fmt.Errorf("failed to link pipeline table: %v", err)
+	}
+	pipeline.TableID = &result.TableID
+
+	return result.RowsImported, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SetSchemaPolicy changes how a table handles files with added or missing columns
+func (h *Handlers) SetSchemaPolicy(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var policy models.SchemaPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.NormalizeSchemaPolicy(&policy); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Invalid schema policy: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		writeServerError(w, r, "Failed to serialize schema policy", err)
+		return
+	}
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE data_tables SET schema_policy = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, policyJSON, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to store schema policy", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// GetSchemaHistory returns every recorded version of a table's schema
+func (h *Handlers) GetSchemaHistory(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	response := models.SchemaHistoryResponse{
+		TableID:  tableID,
+		Policy:   utils.DefaultSchemaPolicy(),
+		Versions: []models.SchemaVersion{},
+	}
+
+	if err := h.authorizeTable(tableID, userID, permViewer); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	var policyJSON []byte
+	err := h.db.QueryRow(`
+		SELECT schema_version, schema_policy
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tableID).Scan(&response.CurrentVersion, &policyJSON)
+
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if policyJSON != nil {
+		if err := json.Unmarshal(policyJSON, &response.Policy); err != nil {
+			writeServerError(w, r, "Failed to parse schema policy", err)
+			return
+		}
+	}
+
+	rows, err := h.db.Query(`
+		SELECT version, table_schema, changes, filename, created_at
+		FROM schema_versions
+		WHERE table_id = $1
+		ORDER BY version
+	`, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve schema history", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version models.SchemaVersion
+		var schemaJSON, changesJSON []byte
+		if err := rows.Scan(&version.Version, &schemaJSON, &changesJSON, &version.Filename, &version.CreatedAt); err != nil {
+			writeServerError(w, r, "Failed to scan schema version", err)
+			return
+		}
+		if err := json.Unmarshal(schemaJSON, &version.TableSchema); err != nil {
+			writeServerError(w, r, "Failed to parse table schema", err)
+			return
+		}
+		if err := json.Unmarshal(changesJSON, &version.Changes); err != nil {
+			writeServerError(w, r, "Failed to parse schema changes", err)
+			return
+		}
+		response.Versions = append(response.Versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"net/http"
+)
+
+// createSession starts a login session and returns its ID with its first refresh token
+func (h *Handlers) createSession(userID, workspaceID string) (string, string, error) {
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	var sessionID string
+	err = h.db.QueryRow(`
+		INSERT INTO sessions (user_id, workspace_id, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+		RETURNING id
+	`, userID, workspaceID, utils.HashToken(refreshToken), utils.RefreshTokenTTL().Seconds()).Scan(&sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sessionID, refreshToken, nil
+}
+
+// writeAuthResponse issues an access token for the session with the user's current role
+// and scopes, and writes it with the refresh token, if any
+func (h *Handlers) writeAuthResponse(w http.ResponseWriter, r *http.Request, userID, email, workspaceID, sessionID, refreshToken string) {
+	role, scopes, err := h.userAccess(userID)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	token, err := utils.GenerateToken(userID, email, workspaceID, sessionID, role, scopes)
+	if err != nil {
+		writeServerError(w, r, "Failed to generate token", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := models.AuthResponse{
+		Token:        token,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+		WorkspaceID:  workspaceID,
+		Role:         role,
+		Scopes:       scopes,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// SessionActive reports whether a session exists for the user and hasn't been revoked or expired
+func (h *Handlers) SessionActive(sessionID, userID string) (bool, error) {
+	var active bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		)
+	`, sessionID, userID).Scan(&active)
+	return active, err
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// Presenting a refresh token that was already exchanged revokes the whole session.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, `{"error": "refresh_token is required"}`, http.StatusBadRequest)
+		return
+	}
+	tokenHash := utils.HashToken(req.RefreshToken)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var sessionID, userID, email string
+	var workspaceID sql.NullString
+	var current, active bool
+	err = tx.QueryRow(`
+		SELECT s.id, s.user_id, u.email, s.workspace_id, s.refresh_token_hash = $1,
+			s.revoked_at IS NULL AND s.expires_at > CURRENT_TIMESTAMP
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.refresh_token_hash = $1 OR s.previous_refresh_token_hash = $1
+		FOR UPDATE OF s
+	`, tokenHash).Scan(&sessionID, &userID, &email, &workspaceID, &current, &active)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	middleware.SetAuditUser(r, userID, email)
+
+	if !active {
+		http.Error(w, `{"error": "Session has expired or been revoked"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// An old refresh token coming back means it leaked; end the session for everyone holding it
+	if !current {
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1`, sessionID); err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeServerError(w, r, "Database error", err)
+			return
+		}
+		http.Error(w, `{"error": "Refresh token has already been used; session revoked"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// Fall back to the default workspace if the user has left the session's one
+	resolved, err := h.resolveWorkspace(userID, workspaceID.String)
+	if err == errWorkspaceNotFound {
+		resolved, err = h.resolveWorkspace(userID, "")
+	}
+	if err == errWorkspaceNotFound {
+		http.Error(w, `{"error": "Not a member of any workspace"}`, http.StatusForbidden)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		writeServerError(w, r, "Failed to generate token", err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sessions
+		SET previous_refresh_token_hash = refresh_token_hash, refresh_token_hash = $1,
+			workspace_id = $2, expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3),
+			last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, utils.HashToken(refreshToken), resolved, utils.RefreshTokenTTL().Seconds(), sessionID)
+	if err != nil {
+		writeServerError(w, r, "Failed to refresh session", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to refresh session", err)
+		return
+	}
+
+	h.writeAuthResponse(w, r, userID, email, resolved, sessionID, refreshToken)
+}
+
+// Logout revokes the session the request's token was issued under
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	_, err := h.db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, middleware.GetSessionIDFromContext(r), userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to log out", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message": "Logged out",
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// LogoutAll revokes every session of the authenticated user, on all devices
+func (h *Handlers) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+	if !requireLogin(w, r) {
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to log out", err)
+		return
+	}
+	revoked, _ := result.RowsAffected()
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"message":          "Logged out of all sessions",
+		"sessions_revoked": revoked,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const shareColumns = `s.id, s.table_id, s.user_id, u.email, s.group_id, g.name, s.permission, s.created_by, s.created_at`
+
+const shareJoins = `
+	FROM table_shares s
+	LEFT JOIN users u ON u.id = s.user_id
+	LEFT JOIN user_groups g ON g.id = s.group_id`
+
+// scanShare reads a table share selected with shareColumns
+func scanShare(row rowScanner) (*models.TableShare, error) {
+	var share models.TableShare
+	err := row.Scan(&share.ID, &share.TableID, &share.UserID, &share.UserEmail, &share.GroupID,
+		&share.GroupName, &share.Permission, &share.CreatedBy, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// ListTableShares returns the users and groups a table is shared with
+func (h *Handlers) ListTableShares(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT `+shareColumns+shareJoins+`
+		WHERE s.table_id = $1
+		ORDER BY s.created_at
+	`, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve shares", err)
+		return
+	}
+	defer rows.Close()
+
+	response := models.TableShareListResponse{
+		TableID: tableID,
+		Shares:  []models.TableShare{},
+	}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			writeServerError(w, r, "Failed to scan share", err)
+			return
+		}
+		response.Shares = append(response.Shares, *share)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ShareTable grants a user or group access to a table, replacing any earlier grant
+func (h *Handlers) ShareTable(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var req models.ShareTableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if (req.Email == "") == (req.GroupID == "") {
+		http.Error(w, `{"error": "Provide either email or group_id"}`, http.StatusBadRequest)
+		return
+	}
+	if _, ok := parsePermission(req.Permission); !ok {
+		http.Error(w, `{"error": "permission must be viewer, editor or owner"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	if req.Email != "" {
+		h.shareTableWithEmail(w, r, tableID, userID, req)
+		return
+	}
+
+	// Tables can be shared with groups the caller owns or belongs to
+	var visible bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_groups g
+			WHERE g.id = $1 AND (g.owner_id = $2 OR EXISTS (
+				SELECT 1 FROM group_members m WHERE m.group_id = g.id AND m.user_id = $2))
+		)
+	`, req.GroupID, userID).Scan(&visible)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if !visible {
+		http.Error(w, `{"error": "Group not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var shareID string
+	err = h.db.QueryRow(`
+		INSERT INTO table_shares (table_id, group_id, permission, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (table_id, group_id) WHERE group_id IS NOT NULL
+		DO UPDATE SET permission = EXCLUDED.permission
+		RETURNING id
+	`, tableID, req.GroupID, req.Permission, userID).Scan(&shareID)
+	if err != nil {
+		writeServerError(w, r, "Failed to share table", err)
+		return
+	}
+
+	share, err := scanShare(h.db.QueryRow(`SELECT `+shareColumns+shareJoins+` WHERE s.id = $1`, shareID))
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve share", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+// shareTableWithEmail shares a table with the user registered under the request's email.
+// It answers the same whether or not there is one, so sharing can't be used to find out
+// who has an account.
+func (h *Handlers) shareTableWithEmail(w http.ResponseWriter, r *http.Request, tableID, userID string, req models.ShareTableRequest) {
+	// The table's uploader already has every permission, so there is nothing to grant
+	var targetID string
+	err := h.db.QueryRow(`
+		SELECT u.id FROM users u JOIN data_tables d ON d.id = $2
+		WHERE u.email = $1 AND u.id <> d.user_id
+	`, req.Email, tableID).Scan(&targetID)
+	if err == nil {
+		_, err = h.db.Exec(`
+			INSERT INTO table_shares (table_id, user_id, permission, created_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (table_id, user_id) WHERE user_id IS NOT NULL
+			DO UPDATE SET permission = EXCLUDED.permission
+		`, tableID, targetID, req.Permission, userID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		writeServerError(w, r, "Failed to share table", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	response := map[string]string{
+		"message":    "If the email belongs to a registered user, the table is shared with them",
+		"table_id":   tableID,
+		"email":      req.Email,
+		"permission": req.Permission,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeTableShare removes a user's or group's access to a table
+func (h *Handlers) RevokeTableShare(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	tableID := vars["id"]
+	shareID := vars["share_id"]
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM table_shares WHERE id = $1 AND table_id = $2`, shareID, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to revoke share", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Share not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":  "Share revoked",
+		"share_id": shareID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
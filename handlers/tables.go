@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// UpdateTable renames a table and/or changes its description
+func (h *Handlers) UpdateTable(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var req models.UpdateTableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var assignments []string
+	var args []interface{}
+	if req.TableName != nil {
+		name := strings.TrimSpace(*req.TableName)
+		if err := utils.ValidateTableName(name); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		args = append(args, name)
+		assignments = append(assignments, fmt.Sprintf("table_name = $%d", len(args)))
+	}
+	if req.Description != nil {
+		args = append(args, strings.TrimSpace(*req.Description))
+		assignments = append(assignments, fmt.Sprintf("description = $%d", len(args)))
+	}
+	if len(assignments) == 0 {
+		http.Error(w, `{"error": "Nothing to update"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	args = append(args, tableID)
+	query := fmt.Sprintf(`
+		UPDATE data_tables SET %s
+		WHERE id = $%d AND deleted_at IS NULL
+		RETURNING id, table_name, description, original_filename, column_count, row_count, created_at
+	`, strings.Join(assignments, ", "), len(args))
+
+	var table models.DataTableSummary
+	err := h.db.QueryRow(query, args...).Scan(&table.ID, &table.Name, &table.Description, &table.Filename,
+		&table.Columns, &table.Rows, &table.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to update table", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(table)
+}
+
+// columnChange holds a locked table while one of its columns is changed
+type columnChange struct {
+	tx            *sql.Tx
+	tableID       string
+	tableRef      string
+	tableSchema   map[string]interface{}
+	schemaVersion int
+	rules         *models.ValidationRules
+}
+
+// beginColumnChange locks a table the user owns for a column change
+func (h *Handlers) beginColumnChange(tableID, userID string) (*columnChange, error) {
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		return nil, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	change := &columnChange{tx: tx, tableID: tableID}
+	var schemaName, physicalTableName string
+	var schemaJSON, rulesJSON []byte
+	err = tx.QueryRow(`
+		SELECT COALESCE(schema_name, ''), physical_table_name, table_schema, schema_version, validation_rules
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, tableID).Scan(&schemaName, &physicalTableName, &schemaJSON, &change.schemaVersion, &rulesJSON)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	change.tableRef = utils.QuoteTableName(schemaName, physicalTableName)
+
+	if err := json.Unmarshal(schemaJSON, &change.tableSchema); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to parse table schema: %v", err)
+	}
+
+	if rulesJSON != nil {
+		change.rules = &models.ValidationRules{}
+		if err := json.Unmarshal(rulesJSON, change.rules); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to parse validation rules: %v", err)
+		}
+	}
+
+	return change, nil
+}
+
+// commit stores the new schema as a new schema version and commits the change
+func (c *columnChange) commit(changes []models.SchemaChange) (int, error) {
+	schemaJSON, err := json.Marshal(c.tableSchema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize table schema: %v", err)
+	}
+
+	var rulesJSON []byte
+	if c.rules != nil {
+		if rulesJSON, err = json.Marshal(c.rules); err != nil {
+			return 0, fmt.Errorf("failed to serialize validation rules: %v", err)
+		}
+	}
+
+	version := c.schemaVersion + 1
+	_, err = c.tx.Exec(`
+		UPDATE data_tables
+		SET table_schema = $1, column_count = $2, schema_version = $3, validation_rules = $4
+		WHERE id = $5
+	`, schemaJSON, len(c.tableSchema), version, rulesJSON, c.tableID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update table schema: %v", err)
+	}
+
+	if err := recordSchemaVersion(c.tx, c.tableID, version, schemaJSON, changes, ""); err != nil {
+		return 0, err
+	}
+
+	if err := c.tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit column change: %v", err)
+	}
+
+	return version, nil
+}
+
+// UpdateColumn renames a column and/or changes its type
+func (h *Handlers) UpdateColumn(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	tableID := vars["id"]
+	column := vars["column"]
+
+	var req models.UpdateColumnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil && req.Type == nil {
+		http.Error(w, `{"error": "Nothing to update"}`, http.StatusBadRequest)
+		return
+	}
+
+	var newType string
+	if req.Type != nil {
+		newType = strings.ToUpper(strings.TrimSpace(*req.Type))
+		switch newType {
+		case "INTEGER", "NUMERIC", "DATE", "TEXT":
+		default:
+			http.Error(w, `{"error": "type must be INTEGER, NUMERIC, DATE or TEXT"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	change, err := h.beginColumnChange(tableID, userID)
+	if err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+	defer change.tx.Rollback()
+
+	info, ok := change.tableSchema[column].(map[string]interface{})
+	if !ok {
+		http.Error(w, `{"error": "Column not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var changes []models.SchemaChange
+
+	currentType, _ := info["type"].(string)
+	if newType != "" && newType != strings.ToUpper(currentType) {
+		_, err := change.tx.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" TYPE %s USING "%s"::%s`,
+			change.tableRef, column, newType, column, newType))
+		if pqErr, ok := invalidValueError(err); ok {
+			// Values that don't convert are the caller's to fix, e.g. "abc" into INTEGER
+			writeError(w, http.StatusBadRequest, "Failed to change column type", pqErr.Message)
+			return
+		} else if err != nil {
+			writeServerError(w, r, "Failed to change column type", err)
+			return
+		}
+		info["type"] = newType
+		changes = append(changes, models.SchemaChange{Action: "change_type", Column: column, From: currentType, To: newType})
+	}
+
+	if req.Name != nil {
+		newName := utils.SanitizeColumnName(strings.TrimSpace(*req.Name))
+		if newName != column {
+			if newName == "id" || newName == "created_at" {
+				http.Error(w, `{"error": "Column name is reserved"}`, http.StatusBadRequest)
+				return
+			}
+			if _, exists := change.tableSchema[newName]; exists {
+				http.Error(w, `{"error": "A column with that name already exists"}`, http.StatusConflict)
+				return
+			}
+
+			_, err := change.tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME COLUMN "%s" TO "%s"`,
+				change.tableRef, column, newName))
+			if err != nil {
+				writeServerError(w, r, "Failed to rename column", err)
+				return
+			}
+
+			delete(change.tableSchema, column)
+			change.tableSchema[newName] = info
+			if change.rules != nil {
+				utils.RenameRuleColumn(change.rules, column, newName)
+			}
+			changes = append(changes, models.SchemaChange{Action: "rename_column", Column: newName, From: column, To: newName})
+		}
+	}
+
+	if len(changes) == 0 {
+		http.Error(w, `{"error": "Column already matches the requested change"}`, http.StatusBadRequest)
+		return
+	}
+
+	version, err := change.commit(changes)
+	if err != nil {
+		writeServerError(w, r, "Failed to commit column change", err)
+		return
+	}
+
+	response := models.ColumnChangeResponse{
+		TableID:       tableID,
+		TableSchema:   change.tableSchema,
+		SchemaVersion: version,
+		Changes:       changes,
+		Message:       "Column updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DropColumn removes a column from a table
+func (h *Handlers) DropColumn(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	tableID := vars["id"]
+	column := vars["column"]
+
+	change, err := h.beginColumnChange(tableID, userID)
+	if err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+	defer change.tx.Rollback()
+
+	info, ok := change.tableSchema[column].(map[string]interface{})
+	if !ok {
+		http.Error(w, `{"error": "Column not found"}`, http.StatusNotFound)
+		return
+	}
+	if len(change.tableSchema) == 1 {
+		http.Error(w, `{"error": "Cannot drop the last column of a table"}`, http.StatusBadRequest)
+		return
+	}
+
+	_, err = change.tx.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN "%s"`, change.tableRef, column))
+	if err != nil {
+		writeServerError(w, r, "Failed to drop column", err)
+		return
+	}
+
+	delete(change.tableSchema, column)
+	if change.rules != nil {
+		utils.RenameRuleColumn(change.rules, column, "")
+	}
+
+	currentType, _ := info["type"].(string)
+	changes := []models.SchemaChange{{Action: "drop_column", Column: column, From: currentType}}
+
+	version, err := change.commit(changes)
+	if err != nil {
+		writeServerError(w, r, "Failed to commit column change", err)
+		return
+	}
+
+	response := models.ColumnChangeResponse{
+		TableID:       tableID,
+		TableSchema:   change.tableSchema,
+		SchemaVersion: version,
+		Changes:       changes,
+		Message:       "Column dropped successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
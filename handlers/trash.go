@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// getTrashRetention returns how long deleted tables are kept, from TRASH_RETENTION
+func getTrashRetention() time.Duration {
+	retention := 30 * 24 * time.Hour // 30 days default
+	if retentionStr := os.Getenv("TRASH_RETENTION"); retentionStr != "" {
+		if d, err := time.ParseDuration(retentionStr); err == nil && d > 0 {
+			retention = d
+		}
+	}
+	return retention
+}
+
+// ListTrash returns the deleted tables the authenticated user owns
+func (h *Handlers) ListTrash(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT d.id, d.table_name, d.original_filename, d.row_count, d.column_count, d.created_at, d.deleted_at
+		FROM data_tables d
+		WHERE d.deleted_at IS NOT NULL AND `+tablePermissionSQL+` = 3
+		ORDER BY d.deleted_at DESC
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve trash", err)
+		return
+	}
+	defer rows.Close()
+
+	retention := getTrashRetention()
+	tables := []models.TrashedTable{}
+	for rows.Next() {
+		var table models.TrashedTable
+		if err := rows.Scan(&table.ID, &table.Name, &table.Filename, &table.Rows, &table.Columns,
+			&table.CreatedAt, &table.DeletedAt); err != nil {
+			writeServerError(w, r, "Failed to scan table data", err)
+			return
+		}
+		table.PurgeAt = table.DeletedAt.Add(retention)
+		tables = append(tables, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.TrashListResponse{
+		Tables: tables,
+		Total:  len(tables),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RestoreTable moves a deleted table out of the trash under its original name
+func (h *Handlers) RestoreTable(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var schemaName, physicalTableName, trashTableName, ownerID, workspaceID string
+	var rowCount int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(d.schema_name, ''), d.physical_table_name, d.trash_table_name,
+			COALESCE(d.user_id::text, ''), COALESCE(d.organization_id::text, ''), d.row_count
+		FROM data_tables d
+		WHERE d.id = $2 AND d.deleted_at IS NOT NULL AND `+tablePermissionSQL+` = 3
+		FOR UPDATE OF d
+	`, userID, tableID).Scan(&schemaName, &physicalTableName, &trashTableName, &ownerID, &workspaceID, &rowCount)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found in trash"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// A table uploaded under the same name since the deletion owns the physical name now
+	var taken bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM data_tables
+			WHERE physical_table_name = $1 AND COALESCE(schema_name, '') = $2
+				AND deleted_at IS NULL AND id <> $3
+		)
+	`, physicalTableName, schemaName, tableID).Scan(&taken)
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	if taken {
+		http.Error(w, `{"error": "A table with the same name exists; rename or delete it before restoring"}`, http.StatusConflict)
+		return
+	}
+
+	// Trashed tables already count towards storage, but not towards tables and rows
+	if err := checkQuota(tx, ownerID, workspaceID, 1, rowCount, 0); err != nil {
+		if qErr, ok := err.(*quotaError); ok {
+			writeQuotaError(w, qErr)
+			return
+		}
+		writeServerError(w, r, "Failed to check quota", err)
+		return
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME TO "%s"`, utils.QuoteTableName(schemaName, trashTableName), physicalTableName))
+	if err != nil {
+		writeServerError(w, r, "Failed to restore table", err)
+		return
+	}
+
+	var table models.DataTableSummary
+	err = tx.QueryRow(`
+		UPDATE data_tables SET deleted_at = NULL, trash_table_name = NULL
+		WHERE id = $1
+		RETURNING id, table_name, description, original_filename, column_count, row_count, created_at
+	`, tableID).Scan(&table.ID, &table.Name, &table.Description, &table.Filename,
+		&table.Columns, &table.Rows, &table.CreatedAt)
+	if err != nil {
+		writeServerError(w, r, "Failed to update table metadata", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit table restore", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(table)
+}
+
+// PurgeTable permanently removes a table from the trash
+func (h *Handlers) PurgeTable(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var schemaName, trashTableName string
+	err := h.db.QueryRow(`
+		SELECT COALESCE(d.schema_name, ''), d.trash_table_name FROM data_tables d
+		WHERE d.id = $2 AND d.deleted_at IS NOT NULL AND `+tablePermissionSQL+` = 3
+	`, userID, tableID).Scan(&schemaName, &trashTableName)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found in trash"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if err := h.purgeTable(tableID, schemaName, trashTableName); err != nil {
+		writeServerError(w, r, "Failed to purge table", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":  "Table permanently deleted",
+		"table_id": tableID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// StartTrashPurger removes tables past the retention period every interval in the background
+func (h *Handlers) StartTrashPurger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			h.purgeExpiredTables()
+		}
+	}()
+}
+
+// purgeExpiredTables permanently removes every table deleted longer ago than the retention period
+func (h *Handlers) purgeExpiredTables() {
+	rows, err := h.db.Query(`
+		SELECT id, COALESCE(schema_name, ''), trash_table_name FROM data_tables
+		WHERE deleted_at IS NOT NULL AND deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`, getTrashRetention().Seconds())
+	if err != nil {
+		slog.Error("Failed to query expired tables", "error", err)
+		return
+	}
+
+	type expiredTable struct {
+		id, schemaName, trashTableName string
+	}
+	var expired []expiredTable
+	for rows.Next() {
+		var table expiredTable
+		if err := rows.Scan(&table.id, &table.schemaName, &table.trashTableName); err != nil {
+			slog.Error("Failed to scan expired table", "error", err)
+			continue
+		}
+		expired = append(expired, table)
+	}
+	rows.Close()
+
+	for _, table := range expired {
+		if err := h.purgeTable(table.id, table.schemaName, table.trashTableName); err != nil {
+			slog.Error("Failed to purge table", "error", err, "table_id", table.id)
+		}
+	}
+}
+
+// purgeTable drops a trashed table with its version snapshots and deletes its metadata
+func (h *Handlers) purgeTable(tableID, schemaName, trashTableName string) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := dropTableStorage(tx, tableID, schemaName, trashTableName); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM data_tables WHERE id = $1 AND deleted_at IS NOT NULL`, tableID); err != nil {
+		return fmt.Errorf("failed to delete table metadata: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// dropTableStorage drops a table's physical table and its version snapshots; the caller
+// deletes the metadata
+func dropTableStorage(db dbExecutor, tableID, schemaName, physicalTableName string) error {
+	snapshots, err := db.Query(`
+		SELECT snapshot_table_name FROM table_versions
+		WHERE table_id = $1 AND snapshot_table_name IS NOT NULL
+	`, tableID)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %v", err)
+	}
+	tableNames := []string{physicalTableName}
+	for snapshots.Next() {
+		var name string
+		if err := snapshots.Scan(&name); err != nil {
+			snapshots.Close()
+			return fmt.Errorf("failed to scan snapshot: %v", err)
+		}
+		tableNames = append(tableNames, name)
+	}
+	snapshots.Close()
+
+	for _, name := range tableNames {
+		if _, err := db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, utils.QuoteTableName(schemaName, name))); err != nil {
+			return fmt.Errorf("failed to drop table %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -22,13 +22,7 @@ func (h *Handlers) UploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse multipart form
-	maxFileSize := int64(10 << 20) // 10MB default
-	if sizeStr := os.Getenv("MAX_FILE_SIZE"); sizeStr != "" {
-		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
-			maxFileSize = size
-		}
-	}
-
+	maxFileSize := getMaxFileSize()
 	if err := r.ParseMultipartForm(maxFileSize); err != nil {
 		http.Error(w, `{"error": "File too large or invalid form data"}`, http.StatusBadRequest)
 		return
@@ -48,63 +42,104 @@ func (h *Handlers) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get table name from form
+	// Loading into an existing table appends to or replaces its rows
+	targetTableID := r.FormValue("table_id")
+	mode := r.FormValue("mode")
 	tableName := r.FormValue("table_name")
-	if err := utils.ValidateTableName(tableName); err != nil {
+	if targetTableID != "" {
+		if mode == "" {
+			mode = "append"
+		}
+		if mode != "append" && mode != "replace" {
+			http.Error(w, `{"error": "mode must be 'append' or 'replace'"}`, http.StatusBadRequest)
+			return
+		}
+
+		if err := h.authorizeTable(targetTableID, userID, permEditor); err != nil {
+			writeTableAccessError(w, r, err)
+			return
+		}
+
+		err := h.db.QueryRow(`
+			SELECT table_name FROM data_tables WHERE id = $1 AND deleted_at IS NULL
+		`, targetTableID).Scan(&tableName)
+		if err != nil {
+			writeTableAccessError(w, r, err)
+			return
+		}
+	} else if err := utils.ValidateTableName(tableName); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	// Parse CSV file
-	csvData, err := utils.ParseCSV(file)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to parse CSV: %s"}`, err.Error()), http.StatusBadRequest)
-		return
+	// New tables are created in the current workspace
+	var workspaceID string
+	if targetTableID == "" {
+		var ok bool
+		if workspaceID, ok = h.requireWorkspaceWriter(w, r); !ok {
+			return
+		}
 	}
 
-	// Generate physical table name
-	physicalTableName := utils.SanitizeTableName(userID, tableName)
-
-	// Create dynamic table
-	if err := h.createDynamicTable(physicalTableName, csvData.Headers); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to create table: %s"}`, err.Error()), http.StatusInternalServerError)
+	// Optional validation rules and schema policy for a new table
+	var opts tableOptions
+	if rulesStr := r.FormValue("rules"); rulesStr != "" {
+		opts.Rules = &models.ValidationRules{}
+		if err := json.Unmarshal([]byte(rulesStr), opts.Rules); err != nil {
+			http.Error(w, `{"error": "Invalid validation rules"}`, http.StatusBadRequest)
+			return
+		}
+		if err := utils.NormalizeRules(opts.Rules); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "Invalid validation rules: %s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+	if policyStr := r.FormValue("schema_policy"); policyStr != "" {
+		opts.Policy = &models.SchemaPolicy{}
+		if err := json.Unmarshal([]byte(policyStr), opts.Policy); err != nil {
+			http.Error(w, `{"error": "Invalid schema policy"}`, http.StatusBadRequest)
+			return
+		}
+		if err := utils.NormalizeSchemaPolicy(opts.Policy); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "Invalid schema policy: %s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+	if targetTableID != "" && (opts.Rules != nil || opts.Policy != nil) {
+		http.Error(w, `{"error": "Rules and schema policy of an existing table are set on /tables/{id}"}`, http.StatusBadRequest)
 		return
 	}
 
-	// Insert data into dynamic table
-	rowsInserted, err := h.insertCSVData(physicalTableName, csvData)
+	// Parse CSV file
+	csvData, err := utils.ParseCSV(file)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to insert data: %s"}`, err.Error()), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to parse CSV: %s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	// Store table metadata
-	tableSchema := make(map[string]interface{})
-	for _, col := range csvData.Headers {
-		tableSchema[col.Name] = map[string]string{
-			"type":   col.DataType,
-			"sample": col.Sample,
-		}
+	// Create the table, or load into the existing one
+	var result *loadResult
+	if targetTableID != "" {
+		result, err = h.loadIntoTable(targetTableID, userID, fileHeader.Filename, csvData, mode)
+	} else {
+		result, err = h.importCSV(userID, workspaceID, tableName, fileHeader.Filename, csvData, opts)
 	}
-
-	schemaJSON, err := json.Marshal(tableSchema)
-	if err != nil {
-		http.Error(w, `{"error": "Failed to serialize table schema"}`, http.StatusInternalServerError)
+	if vErr, ok := err.(*validationError); ok {
+		writeValidationError(w, vErr)
 		return
-	}
-
-	var tableID string
-	err = h.db.QueryRow(`
-		INSERT INTO data_tables (user_id, table_name, original_filename, column_count, row_count, table_schema, physical_table_name)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
-	`, userID, tableName, fileHeader.Filename, len(csvData.Headers), rowsInserted, schemaJSON, physicalTableName).Scan(&tableID)
-
-	if err != nil {
-		http.Error(w, `{"error": "Failed to store table metadata"}`, http.StatusInternalServerError)
+	} else if sErr, ok := err.(*schemaError); ok {
+		http.Error(w, fmt.Sprintf(`{"error": "Schema mismatch: %s"}`, sErr.Error()), http.StatusUnprocessableEntity)
+		return
+	} else if qErr, ok := err.(*quotaError); ok {
+		writeQuotaError(w, qErr)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to import data", err)
 		return
 	}
 
+	middleware.SetAuditResource(r, result.TableID)
+
 	// Return success response
 	columnNames := make([]string, len(csvData.Headers))
 	for i, col := range csvData.Headers {
@@ -112,21 +147,53 @@ func (h *Handlers) UploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := models.UploadResponse{
-		TableID:      tableID,
-		TableName:    tableName,
-		Filename:     fileHeader.Filename,
-		RowsImported: rowsInserted,
-		Columns:      columnNames,
-		Message:      "Data imported successfully",
+		TableID:         result.TableID,
+		TableName:       tableName,
+		Filename:        fileHeader.Filename,
+		RowsImported:    result.RowsImported,
+		RowsQuarantined: result.RowsQuarantined,
+		Columns:         columnNames,
+		Validation:      result.Report,
+		SchemaChanges:   result.SchemaChanges,
+		Version:         result.Version,
+		Message:         "Data imported successfully",
+	}
+
+	status := http.StatusCreated
+	if targetTableID != "" {
+		status = http.StatusOK
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
-// createDynamicTable creates a PostgreSQL table based on CSV structure
-func (h *Handlers) createDynamicTable(tableName string, columns []utils.CSVColumn) error {
+// writeValidationError responds with the report of a rejected file
+func writeValidationError(w http.ResponseWriter, vErr *validationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	response := map[string]interface{}{
+		"error":      vErr.Error(),
+		"validation": vErr.report,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// getMaxFileSize returns the upload size limit from MAX_FILE_SIZE
+func getMaxFileSize() int64 {
+	maxFileSize := int64(10 << 20) // 10MB default
+	if sizeStr := os.Getenv("MAX_FILE_SIZE"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			maxFileSize = size
+		}
+	}
+	return maxFileSize
+}
+
+// createDynamicTable creates a PostgreSQL table based on CSV structure.
+// tableRef is a quoted table reference from utils.QuoteTableName.
+func createDynamicTable(db dbExecutor, tableRef string, columns []utils.CSVColumn) error {
 	var columnDefs []string
 	columnDefs = append(columnDefs, "id SERIAL PRIMARY KEY")
 	
@@ -136,14 +203,14 @@ func (h *Handlers) createDynamicTable(tableName string, columns []utils.CSVColum
 	}
 	columnDefs = append(columnDefs, "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP")
 
-	query := fmt.Sprintf(`CREATE TABLE "%s" (%s)`, tableName, strings.Join(columnDefs, ", "))
+	query := fmt.Sprintf(`CREATE TABLE %s (%s)`, tableRef, strings.Join(columnDefs, ", "))
 	
-	_, err := h.db.Exec(query)
+	_, err := db.Exec(query)
 	return err
 }
 
-// insertCSVData inserts CSV data into the dynamic table
-func (h *Handlers) insertCSVData(tableName string, csvData *utils.CSVData) (int, error) {
+// insertCSVData inserts CSV data into the dynamic table behind tableRef
+func insertCSVData(db dbExecutor, tableRef string, csvData *utils.CSVData) (int, error) {
 	if len(csvData.Rows) == 0 {
 		return 0, nil
 	}
@@ -160,8 +227,8 @@ func (h *Handlers) insertCSVData(tableName string, csvData *utils.CSVData) (int,
 		placeholders[i] = fmt.Sprintf("$%d", i+1)
 	}
 
-	query := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`,
-		tableName,
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+		tableRef,
 		strings.Join(columnNames, ", "),
 		strings.Join(placeholders, ", "))
 
@@ -178,7 +245,7 @@ func (h *Handlers) insertCSVData(tableName string, csvData *utils.CSVData) (int,
 			}
 		}
 
-		_, err := h.db.Exec(query, values...)
+		_, err := db.Exec(query, values...)
 		if err != nil {
 			return insertedCount, fmt.Errorf("failed to insert row %d: %v", insertedCount+1, err)
 		}
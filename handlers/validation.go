@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SetTableRules attaches or replaces the validation rules of a table
+func (h *Handlers) SetTableRules(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var rules models.ValidationRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.NormalizeRules(&rules); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Invalid validation rules: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		writeServerError(w, r, "Failed to serialize validation rules", err)
+		return
+	}
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE data_tables SET validation_rules = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, rulesJSON, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to store validation rules", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// DeleteTableRules removes the validation rules of a table
+func (h *Handlers) DeleteTableRules(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	if err := h.authorizeTable(tableID, userID, permOwner); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE data_tables SET validation_rules = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to remove validation rules", err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]string{
+		"message":  "Validation rules removed",
+		"table_id": tableID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTableValidation returns the rules, latest report and quarantined rows of a table
+func (h *Handlers) GetTableValidation(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	if err := h.authorizeTable(tableID, userID, permViewer); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	var rulesJSON, reportJSON []byte
+	err := h.db.QueryRow(`
+		SELECT validation_rules, validation_report
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tableID).Scan(&rulesJSON, &reportJSON)
+
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	response := models.ValidationStatusResponse{
+		Quarantined: []models.QuarantinedRow{},
+	}
+	if rulesJSON != nil {
+		if err := json.Unmarshal(rulesJSON, &response.Rules); err != nil {
+			writeServerError(w, r, "Failed to parse validation rules", err)
+			return
+		}
+	}
+	if reportJSON != nil {
+		if err := json.Unmarshal(reportJSON, &response.Report); err != nil {
+			writeServerError(w, r, "Failed to parse validation report", err)
+			return
+		}
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, row_number, filename, data, errors, created_at
+		FROM quarantined_rows
+		WHERE table_id = $1
+		ORDER BY created_at DESC, row_number
+		LIMIT 100
+	`, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve quarantined rows", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.QuarantinedRow
+		var dataJSON, errorsJSON []byte
+		if err := rows.Scan(&row.ID, &row.RowNumber, &row.Filename, &dataJSON, &errorsJSON, &row.CreatedAt); err != nil {
+			writeServerError(w, r, "Failed to scan quarantined row", err)
+			return
+		}
+		if err := json.Unmarshal(dataJSON, &row.Data); err != nil {
+			writeServerError(w, r, "Failed to parse quarantined row", err)
+			return
+		}
+		if err := json.Unmarshal(errorsJSON, &row.Errors); err != nil {
+			writeServerError(w, r, "Failed to parse quarantined row", err)
+			return
+		}
+		response.Quarantined = append(response.Quarantined, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Purposes of the single-use tokens sent by email
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+)
+
+const (
+	// verifyEmailTTL is how long an email verification link works
+	verifyEmailTTL = 48 * time.Hour
+	// resetPasswordTTL is how long a password reset token works
+	resetPasswordTTL = time.Hour
+)
+
+// issueUserToken creates a single-use token for the user, replacing any unused one with the same purpose
+func (h *Handlers) issueUserToken(userID, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateEmailToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM user_tokens
+		WHERE user_id = $1 AND purpose = $2 AND (used_at IS NULL OR expires_at < CURRENT_TIMESTAMP)
+	`, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+	`, userID, purpose, utils.HashToken(token), ttl.Seconds())
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a token used and returns its user, or sql.ErrNoRows when the
+// token is unknown, expired or already used
+func consumeUserToken(db dbExecutor, token, purpose string) (string, error) {
+	var userID string
+	err := db.QueryRow(`
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`, utils.HashToken(token), purpose).Scan(&userID)
+	return userID, err
+}
+
+// sendEmail delivers a message in the background so response times don't reveal
+// whether an account exists
+func (h *Handlers) sendEmail(to, subject, body string) {
+	go func() {
+		if err := h.mailer.Send(to, subject, body); err != nil {
+			slog.Error("Failed to send email", "error", err, "subject", subject)
+		}
+	}()
+}
+
+// sendVerificationEmail emails the user a link that verifies their address
+func (h *Handlers) sendVerificationEmail(userID, email string) error {
+	token, err := h.issueUserToken(userID, tokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := utils.PublicURL() + "/auth/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Confirm your email address for ETL API by opening this link within %d hours:\n\n%s\n\nIf you didn't create an account, ignore this email.",
+		int(verifyEmailTTL.Hours()), link)
+	h.sendEmail(email, "Verify your email address", body)
+	return nil
+}
+
+// VerifyEmail marks the user's email verified, from the token in the emailed link
+// (?token=) or in a JSON body
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var req models.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		http.Error(w, `{"error": "token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, token, tokenPurposeVerifyEmail)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Verification link is invalid, expired or already used"}`, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to verify email", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to verify email", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification sends a new verification link. It answers the same whether or not
+// the account exists, so it can't be used to discover accounts.
+func (h *Handlers) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var userID, email string
+	err := h.db.QueryRow(`
+		SELECT id, email FROM users WHERE email = $1 AND email_verified_at IS NULL
+	`, req.Email).Scan(&userID, &email)
+	if err == nil {
+		if err := h.sendVerificationEmail(userID, email); err != nil {
+			writeServerError(w, r, "Failed to send verification email", err)
+			return
+		}
+	} else if err != sql.ErrNoRows {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists and isn't verified yet, a verification link is on its way",
+	})
+}
+
+// ForgotPassword emails a password reset token. Like ResendVerification it answers the
+// same for unknown emails.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+	middleware.SetAuditUser(r, "", req.Email)
+
+	// Single sign-on users have no password to reset
+	var userID, email string
+	err := h.db.QueryRow(`
+		SELECT id, email FROM users WHERE email = $1 AND password_hash <> ''
+	`, req.Email).Scan(&userID, &email)
+	if err == nil {
+		token, err := h.issueUserToken(userID, tokenPurposeResetPassword, resetPasswordTTL)
+		if err != nil {
+			writeServerError(w, r, "Failed to start password reset", err)
+			return
+		}
+
+		body := fmt.Sprintf("Someone asked to reset the password of your ETL API account. To choose a new password within %d minutes, send this token to POST %s/auth/reset-password:\n\n%s\n\nIf it wasn't you, ignore this email; your password stays the same.",
+			int(resetPasswordTTL.Minutes()), utils.PublicURL(), token)
+		h.sendEmail(email, "Reset your password", body)
+	} else if err != sql.ErrNoRows {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists, a password reset token is on its way",
+	})
+}
+
+// ResetPassword sets a new password with a reset token and ends every session of the account
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, `{"error": "token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, req.Token, tokenPurposeResetPassword)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Reset token is invalid, expired or already used"}`, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	var email string
+	if err := tx.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	// A rejected password rolls back, so the token still works for another try
+	if err := utils.ValidatePassword(req.Password, email); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeServerError(w, r, "Failed to process password", err)
+		return
+	}
+
+	// Receiving the token proves the user owns the address too
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, string(hashedPassword), userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to reset password", err)
+		return
+	}
+
+	// Whoever knew the old password shouldn't stay logged in
+	_, err = tx.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		writeServerError(w, r, "Failed to reset password", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to reset password", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated; log in with the new password"})
+}
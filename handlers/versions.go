@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"etl-api/middleware"
+	"etl-api/models"
+	"etl-api/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errInvalidVersion  = errors.New("invalid version or as_of parameter")
+	errVersionNotFound = errors.New("version not found")
+)
+
+// tableVersionSource identifies where the rows of a table version are stored
+type tableVersionSource struct {
+	Version    int
+	TableRef   string
+	SchemaJSON []byte
+	RowCount   int
+}
+
+// snapshotVersion freezes the live table as the given version before it changes
+func snapshotVersion(db dbExecutor, tableID, schemaName, physicalTableName string, version int) error {
+	snapshotName := utils.SnapshotTableName(tableID, version)
+
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE %s AS SELECT * FROM %s`,
+		utils.QuoteTableName(schemaName, snapshotName), utils.QuoteTableName(schemaName, physicalTableName)))
+	if err != nil {
+		return fmt.Errorf("failed to snapshot version %d: %v", version, err)
+	}
+
+	// Refresh the version's metadata so it always describes the snapshot's contents
+	_, err = db.Exec(`
+		UPDATE table_versions tv
+		SET snapshot_table_name = $1, table_schema = d.table_schema, row_count = d.row_count
+		FROM data_tables d
+		WHERE d.id = tv.table_id AND tv.table_id = $2 AND tv.version = $3
+	`, snapshotName, tableID, version)
+	if err != nil {
+		return fmt.Errorf("failed to record snapshot of version %d: %v", version, err)
+	}
+
+	return nil
+}
+
+// getVersionRetention returns how many version snapshots each table keeps, from
+// TABLE_VERSION_RETENTION
+func getVersionRetention() int {
+	retention := 10
+	if n, err := strconv.Atoi(os.Getenv("TABLE_VERSION_RETENTION")); err == nil && n > 0 {
+		retention = n
+	}
+	return retention
+}
+
+// pruneSnapshots drops the table's snapshots beyond the newest ones it keeps. Their
+// versions stay in the history but can no longer be read or rolled back to.
+func pruneSnapshots(db dbExecutor, tableID, schemaName string) error {
+	rows, err := db.Query(`
+		WITH expired AS (
+			SELECT id, snapshot_table_name FROM table_versions
+			WHERE table_id = $1 AND snapshot_table_name IS NOT NULL
+			ORDER BY version DESC
+			OFFSET $2
+		)
+		UPDATE table_versions tv SET snapshot_table_name = NULL
+		FROM expired e
+		WHERE tv.id = e.id
+		RETURNING e.snapshot_table_name
+	`, tableID, getVersionRetention())
+	if err != nil {
+		return fmt.Errorf("failed to expire snapshots: %v", err)
+	}
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan snapshot: %v", err)
+		}
+		expired = append(expired, name)
+	}
+	rows.Close()
+
+	for _, name := range expired {
+		if _, err := db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, utils.QuoteTableName(schemaName, name))); err != nil {
+			return fmt.Errorf("failed to drop snapshot %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// recordTableVersion stores the table's current metadata as a new version and makes it current
+func recordTableVersion(db dbExecutor, tableID string, version int, operation, filename, userID string, rolledBackTo *int) error {
+	var source, createdBy interface{}
+	if filename != "" {
+		source = filename
+	}
+	if userID != "" {
+		createdBy = userID
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO table_versions (table_id, version, operation, original_filename, row_count, table_schema, rolled_back_to, created_by)
+		SELECT id, $2, $3, $4, row_count, table_schema, $5, $6
+		FROM data_tables
+		WHERE id = $1
+	`, tableID, version, operation, source, rolledBackTo, createdBy)
+	if err != nil {
+		return fmt.Errorf("failed to record table version: %v", err)
+	}
+
+	if _, err := db.Exec(`UPDATE data_tables SET current_version = $1 WHERE id = $2`, version, tableID); err != nil {
+		return fmt.Errorf("failed to update current version: %v", err)
+	}
+
+	return nil
+}
+
+// resolveTableVersion picks the version requested with ?version= or ?as_of=,
+// returning nil when the current version should be read
+func (h *Handlers) resolveTableVersion(r *http.Request, tableID, schemaName string, currentVersion int) (*tableVersionSource, error) {
+	query := r.URL.Query()
+	versionStr := query.Get("version")
+	asOfStr := query.Get("as_of")
+	if versionStr == "" && asOfStr == "" {
+		return nil, nil
+	}
+
+	var source tableVersionSource
+	var snapshotName sql.NullString
+	var err error
+
+	if versionStr != "" {
+		version, convErr := strconv.Atoi(versionStr)
+		if convErr != nil || version <= 0 {
+			return nil, errInvalidVersion
+		}
+		err = h.db.QueryRow(`
+			SELECT version, snapshot_table_name, table_schema, row_count
+			FROM table_versions
+			WHERE table_id = $1 AND version = $2
+		`, tableID, version).Scan(&source.Version, &snapshotName, &source.SchemaJSON, &source.RowCount)
+	} else {
+		asOf, parseErr := time.Parse(time.RFC3339, asOfStr)
+		if parseErr != nil {
+			return nil, errInvalidVersion
+		}
+		err = h.db.QueryRow(`
+			SELECT version, snapshot_table_name, table_schema, row_count
+			FROM table_versions
+			WHERE table_id = $1 AND created_at <= $2
+			ORDER BY version DESC
+			LIMIT 1
+		`, tableID, asOf.UTC()).Scan(&source.Version, &snapshotName, &source.SchemaJSON, &source.RowCount)
+	}
+
+	if err == sql.ErrNoRows {
+		return nil, errVersionNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve version: %v", err)
+	}
+
+	if source.Version == currentVersion {
+		return nil, nil
+	}
+	if !snapshotName.Valid {
+		return nil, errVersionNotFound
+	}
+	source.TableRef = utils.QuoteTableName(schemaName, snapshotName.String)
+
+	return &source, nil
+}
+
+// ListTableVersions returns every version of a table with its upload metadata
+func (h *Handlers) ListTableVersions(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	response := models.TableVersionListResponse{
+		TableID:  tableID,
+		Versions: []models.TableVersion{},
+	}
+
+	if err := h.authorizeTable(tableID, userID, permViewer); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	err := h.db.QueryRow(`
+		SELECT current_version FROM data_tables WHERE id = $1 AND deleted_at IS NULL
+	`, tableID).Scan(&response.CurrentVersion)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT version, operation, original_filename, row_count, table_schema, rolled_back_to, created_by, created_at
+		FROM table_versions
+		WHERE table_id = $1
+		ORDER BY version DESC
+	`, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to retrieve table versions", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version models.TableVersion
+		var schemaJSON []byte
+		if err := rows.Scan(&version.Version, &version.Operation, &version.OriginalFilename, &version.RowCount,
+			&schemaJSON, &version.RolledBackTo, &version.CreatedBy, &version.CreatedAt); err != nil {
+			writeServerError(w, r, "Failed to scan table version", err)
+			return
+		}
+
+		var tableSchema map[string]interface{}
+		if err := json.Unmarshal(schemaJSON, &tableSchema); err != nil {
+			writeServerError(w, r, "Failed to parse table schema", err)
+			return
+		}
+		version.ColumnCount = len(tableSchema)
+		version.IsCurrent = version.Version == response.CurrentVersion
+
+		response.Versions = append(response.Versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RollbackTable restores an earlier version of a table as a new version
+func (h *Handlers) RollbackTable(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID := middleware.GetUserIDFromContext(r)
+	if userID == "" {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tableID := mux.Vars(r)["id"]
+
+	var req models.RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+		http.Error(w, `{"error": "A positive version is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorizeTable(tableID, userID, permEditor); err != nil {
+		writeTableAccessError(w, r, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var schemaName, physicalTableName, ownerID, workspaceID string
+	var currentVersion, schemaVersion int
+	var currentRowCount int64
+	var currentSchemaJSON []byte
+	err = tx.QueryRow(`
+		SELECT COALESCE(schema_name, ''), physical_table_name, current_version, schema_version, table_schema,
+			COALESCE(user_id::text, ''), COALESCE(organization_id::text, ''), row_count
+		FROM data_tables
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, tableID).Scan(&schemaName, &physicalTableName, &currentVersion, &schemaVersion, &currentSchemaJSON,
+		&ownerID, &workspaceID, &currentRowCount)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Table not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	if req.Version == currentVersion {
+		http.Error(w, `{"error": "Version is already current"}`, http.StatusBadRequest)
+		return
+	}
+
+	var snapshotName sql.NullString
+	var targetSchemaJSON []byte
+	var targetRowCount int
+	err = tx.QueryRow(`
+		SELECT snapshot_table_name, table_schema, row_count
+		FROM table_versions
+		WHERE table_id = $1 AND version = $2
+	`, tableID, req.Version).Scan(&snapshotName, &targetSchemaJSON, &targetRowCount)
+	if err == sql.ErrNoRows || (err == nil && !snapshotName.Valid) {
+		http.Error(w, `{"error": "Version not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Database error", err)
+		return
+	}
+
+	var currentSchema, targetSchema map[string]interface{}
+	if err := json.Unmarshal(currentSchemaJSON, &currentSchema); err != nil {
+		writeServerError(w, r, "Failed to parse table schema", err)
+		return
+	}
+	if err := json.Unmarshal(targetSchemaJSON, &targetSchema); err != nil {
+		writeServerError(w, r, "Failed to parse table schema", err)
+		return
+	}
+
+	// The rollback brings back the version's rows, and the snapshot of the version being
+	// replaced takes as much space as the table does now
+	var tableBytes int64
+	err = tx.QueryRow(`SELECT pg_total_relation_size($1::regclass)`, utils.QuoteTableName(schemaName, physicalTableName)).Scan(&tableBytes)
+	if err != nil {
+		writeServerError(w, r, "Failed to measure table", err)
+		return
+	}
+	if err := checkQuota(tx, ownerID, workspaceID, 0, int64(targetRowCount)-currentRowCount, tableBytes); err != nil {
+		if qErr, ok := err.(*quotaError); ok {
+			writeQuotaError(w, qErr)
+			return
+		}
+		writeServerError(w, r, "Failed to check quota", err)
+		return
+	}
+
+	// Keep the version being replaced reachable
+	if err := snapshotVersion(tx, tableID, schemaName, physicalTableName, currentVersion); err != nil {
+		writeServerError(w, r, "Failed to snapshot version", err)
+		return
+	}
+
+	changes, err := restoreSnapshot(tx, utils.QuoteTableName(schemaName, physicalTableName),
+		utils.QuoteTableName(schemaName, snapshotName.String), schemaTypes(currentSchema), schemaTypes(targetSchema))
+	if err != nil {
+		writeServerError(w, r, "Failed to restore version", err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE data_tables SET table_schema = $1, column_count = $2, row_count = $3
+		WHERE id = $4
+	`, targetSchemaJSON, len(targetSchema), targetRowCount, tableID)
+	if err != nil {
+		writeServerError(w, r, "Failed to update table metadata", err)
+		return
+	}
+
+	if len(changes) > 0 {
+		schemaVersion++
+		if _, err := tx.Exec(`UPDATE data_tables SET schema_version = $1 WHERE id = $2`, schemaVersion, tableID); err != nil {
+			writeServerError(w, r, "Failed to update table metadata", err)
+			return
+		}
+		if err := recordSchemaVersion(tx, tableID, schemaVersion, targetSchemaJSON, changes, ""); err != nil {
+			writeServerError(w, r, "Failed to record schema version", err)
+			return
+		}
+	}
+
+	newVersion := currentVersion + 1
+	if err := recordTableVersion(tx, tableID, newVersion, "rollback", "", userID, &req.Version); err != nil {
+		writeServerError(w, r, "Failed to record table version", err)
+		return
+	}
+
+	// Pruning only now keeps the snapshot just restored from until its rows are copied
+	if err := pruneSnapshots(tx, tableID, schemaName); err != nil {
+		writeServerError(w, r, "Failed to prune snapshots", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, r, "Failed to commit rollback", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"message":        "Table rolled back successfully",
+		"table_id":       tableID,
+		"version":        newVersion,
+		"rolled_back_to": req.Version,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// restoreSnapshot reshapes the live table to the snapshot's columns and copies its rows back
+func restoreSnapshot(db dbExecutor, tableRef, snapshotRef string, current, target map[string]string) ([]models.SchemaChange, error) {
+	var changes []models.SchemaChange
+
+	names := make([]string, 0, len(target))
+	for name := range target {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for name := range current {
+		if _, ok := target[name]; ok {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN "%s"`, tableRef, name)); err != nil {
+			return nil, fmt.Errorf("failed to drop column %s: %v", name, err)
+		}
+		changes = append(changes, models.SchemaChange{Action: "drop_column", Column: name, From: current[name]})
+	}
+
+	for _, name := range names {
+		targetType := target[name]
+		currentType, exists := current[name]
+		switch {
+		case !exists:
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s`, tableRef, name, targetType)); err != nil {
+				return nil, fmt.Errorf("failed to add column %s: %v", name, err)
+			}
+			changes = append(changes, models.SchemaChange{Action: "add_column", Column: name, To: targetType})
+		case currentType != targetType:
+			// Rows are replaced below, so empty the table first to make any cast valid
+			if _, err := db.Exec(fmt.Sprintf(`DELETE FROM %s`, tableRef)); err != nil {
+				return nil, fmt.Errorf("failed to clear table: %v", err)
+			}
+			_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" TYPE %s USING "%s"::%s`,
+				tableRef, name, targetType, name, targetType))
+			if err != nil {
+				return nil, fmt.Errorf("failed to change type of %s: %v", name, err)
+			}
+			changes = append(changes, models.SchemaChange{Action: "change_type", Column: name, From: currentType, To: targetType})
+		}
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`DELETE FROM %s`, tableRef)); err != nil {
+		return nil, fmt.Errorf("failed to clear table: %v", err)
+	}
+
+	columns := `"id", "created_at"`
+	for _, name := range names {
+		columns += fmt.Sprintf(`, "%s"`, name)
+	}
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, tableRef, columns, columns, snapshotRef))
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy rows: %v", err)
+	}
+
+	// Keep the id sequence ahead of the restored rows
+	_, err = db.Exec(fmt.Sprintf(`SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)`, tableRef),
+		tableRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset id sequence: %v", err)
+	}
+
+	return changes, nil
+}
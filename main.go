@@ -4,28 +4,86 @@ import (
 	"etl-api/database"
 	"etl-api/handlers"
 	"etl-api/middleware"
-	"log"
+	"etl-api/utils"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// Log structured lines, JSON unless LOG_FORMAT says otherwise
+	slog.SetDefault(utils.NewLoggerFromEnv(os.Stdout))
+
+	// Load the keys access tokens are signed with before anything can issue one
+	if err := utils.LoadSigningKeys(); err != nil {
+		fatal("Failed to load signing keys", err)
+	}
+
+	// Extend the bundled list of breached passwords new passwords are checked against
+	if err := utils.LoadPasswordBlocklist(); err != nil {
+		fatal("Failed to load password blocklist", err)
+	}
+
 	// Initialize database connection
 	db, err := database.InitDB()
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		fatal("Failed to initialize database", err)
 	}
 	defer db.Close()
 
 	// Run database migrations
 	if err := database.RunMigrations(db); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+		fatal("Failed to run migrations", err)
+	}
+
+	// Give each workspace's existing tables their own schema once isolation is turned on
+	if utils.TenantSchemasEnabled() {
+		if err := database.MoveTablesToTenantSchemas(db); err != nil {
+			fatal("Failed to move tables to tenant schemas", err)
+		}
+	}
+
+	// Pick how verification and password reset emails are sent
+	mailer, err := utils.NewMailerFromEnv()
+	if err != nil {
+		fatal("Failed to configure mail", err)
 	}
 
 	// Initialize handlers with database connection
-	h := handlers.NewHandlers(db)
+	h := handlers.NewHandlers(db, mailer)
+
+	// Reject access tokens whose session has been logged out
+	middleware.UseSessionValidator(h.SessionActive)
+	middleware.UseAPIKeyValidator(h.AuthenticateAPIKey)
+
+	// Keep an append-only record of who did what
+	middleware.UseAuditRecorder(h.RecordAuditEvent)
+
+	// Share rate limit buckets between instances through Postgres when asked to
+	if os.Getenv("RATE_LIMIT_BACKEND") == "postgres" {
+		middleware.UseRateLimitStore(h.TakeRateLimit)
+	}
+
+	// Start the in-process pipeline scheduler
+	schedulerInterval := time.Minute
+	if intervalStr := os.Getenv("SCHEDULER_INTERVAL"); intervalStr != "" {
+		if interval, err := time.ParseDuration(intervalStr); err == nil && interval > 0 {
+			schedulerInterval = interval
+		}
+	}
+	h.StartScheduler(schedulerInterval)
+
+	// Start the purger that removes tables from the trash after TRASH_RETENTION
+	purgeInterval := time.Hour
+	if intervalStr := os.Getenv("TRASH_PURGE_INTERVAL"); intervalStr != "" {
+		if interval, err := time.ParseDuration(intervalStr); err == nil && interval > 0 {
+			purgeInterval = interval
+		}
+	}
+	h.StartTrashPurger(purgeInterval)
 
 	// Create router
 	r := mux.NewRouter()
@@ -33,23 +91,119 @@ func main() {
 	// Health check endpoint
 	r.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
 
+	// Public keys for verifying access tokens
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
+
 	// Authentication routes
 	auth := r.PathPrefix("/auth").Subrouter()
+	auth.Use(middleware.Audit)
+	auth.Use(middleware.RateLimitRequests)
 	auth.HandleFunc("/register", h.Register).Methods("POST")
 	auth.HandleFunc("/login", h.Login).Methods("POST")
+	auth.HandleFunc("/mfa", h.LoginMFA).Methods("POST")
+	auth.HandleFunc("/refresh", h.RefreshToken).Methods("POST")
+	auth.HandleFunc("/verify", h.VerifyEmail).Methods("GET", "POST")
+	auth.HandleFunc("/resend-verification", h.ResendVerification).Methods("POST")
+	auth.HandleFunc("/forgot-password", h.ForgotPassword).Methods("POST")
+	auth.HandleFunc("/reset-password", h.ResetPassword).Methods("POST")
+	auth.HandleFunc("/oidc/login", h.OIDCLogin).Methods("GET")
+	auth.HandleFunc("/oidc/callback", h.OIDCCallback).Methods("GET")
+	auth.Handle("/password", middleware.JWTAuth(http.HandlerFunc(h.ChangePassword))).Methods("PUT")
+	auth.Handle("/logout", middleware.JWTAuth(http.HandlerFunc(h.Logout))).Methods("POST")
+	auth.Handle("/logout-all", middleware.JWTAuth(middleware.RequireScope(middleware.ScopeWrite, h.LogoutAll))).Methods("POST")
+	auth.Handle("/switch-workspace", middleware.JWTAuth(http.HandlerFunc(h.SwitchWorkspace))).Methods("POST")
 
 	// Protected routes - require JWT authentication
 	protected := r.PathPrefix("").Subrouter()
+	protected.Use(middleware.Audit)
+	protected.Use(middleware.RateLimitClients)
 	protected.Use(middleware.JWTAuth)
+	protected.Use(middleware.RateLimitRequests)
 
 	// File upload and data management routes
-	protected.HandleFunc("/upload", h.UploadFile).Methods("POST")
-	protected.HandleFunc("/tables", h.ListTables).Methods("GET")
-	protected.HandleFunc("/tables/{id}", h.DeleteTable).Methods("DELETE")
-	protected.HandleFunc("/data/{table_id}", h.GetTableData).Methods("GET")
+	protected.Handle("/upload", middleware.RequireScope(middleware.ScopeUpload, h.UploadFile)).Methods("POST")
+	protected.Handle("/tables", middleware.RequireScope(middleware.ScopeRead, h.ListTables)).Methods("GET")
+	protected.Handle("/tables/{id}", middleware.RequireScope(middleware.ScopeDelete, h.DeleteTable)).Methods("DELETE")
+	protected.Handle("/tables/{id}", middleware.RequireScope(middleware.ScopeWrite, h.UpdateTable)).Methods("PATCH")
+	protected.Handle("/tables/{id}/restore", middleware.RequireScope(middleware.ScopeWrite, h.RestoreTable)).Methods("POST")
+	protected.Handle("/trash", middleware.RequireScope(middleware.ScopeRead, h.ListTrash)).Methods("GET")
+	protected.Handle("/trash/{id}", middleware.RequireScope(middleware.ScopeDelete, h.PurgeTable)).Methods("DELETE")
+	protected.Handle("/tables/{id}/shares", middleware.RequireScope(middleware.ScopeRead, h.ListTableShares)).Methods("GET")
+	protected.Handle("/tables/{id}/shares", middleware.RequireScope(middleware.ScopeWrite, h.ShareTable)).Methods("POST")
+	protected.Handle("/tables/{id}/shares/{share_id}", middleware.RequireScope(middleware.ScopeDelete, h.RevokeTableShare)).Methods("DELETE")
+	protected.Handle("/tables/{id}/columns/{column}", middleware.RequireScope(middleware.ScopeWrite, h.UpdateColumn)).Methods("PATCH")
+	protected.Handle("/tables/{id}/columns/{column}", middleware.RequireScope(middleware.ScopeDelete, h.DropColumn)).Methods("DELETE")
+	protected.Handle("/data/{table_id}", middleware.RequireScope(middleware.ScopeRead, h.GetTableData)).Methods("GET")
+
+	// Row-level changes to uploaded tables
+	protected.Handle("/data/{table_id}/rows", middleware.RequireScope(middleware.ScopeWrite, h.CreateRow)).Methods("POST")
+	protected.Handle("/data/{table_id}/rows/{row_id}", middleware.RequireScope(middleware.ScopeWrite, h.UpdateRow)).Methods("PATCH")
+	protected.Handle("/data/{table_id}/rows/{row_id}", middleware.RequireScope(middleware.ScopeDelete, h.DeleteRow)).Methods("DELETE")
+
+	// Validation rules (data contracts) per table
+	protected.Handle("/tables/{id}/rules", middleware.RequireScope(middleware.ScopeWrite, h.SetTableRules)).Methods("PUT")
+	protected.Handle("/tables/{id}/rules", middleware.RequireScope(middleware.ScopeDelete, h.DeleteTableRules)).Methods("DELETE")
+	protected.Handle("/tables/{id}/validation", middleware.RequireScope(middleware.ScopeRead, h.GetTableValidation)).Methods("GET")
+
+	// Table versions and rollback
+	protected.Handle("/tables/{id}/versions", middleware.RequireScope(middleware.ScopeRead, h.ListTableVersions)).Methods("GET")
+	protected.Handle("/tables/{id}/rollback", middleware.RequireScope(middleware.ScopeWrite, h.RollbackTable)).Methods("POST")
+
+	// Schema evolution policy and history
+	protected.Handle("/tables/{id}/schema-policy", middleware.RequireScope(middleware.ScopeWrite, h.SetSchemaPolicy)).Methods("PUT")
+	protected.Handle("/tables/{id}/schema/history", middleware.RequireScope(middleware.ScopeRead, h.GetSchemaHistory)).Methods("GET")
+
+	// Organizations (workspaces) and their members
+	protected.Handle("/organizations", middleware.RequireScope(middleware.ScopeWrite, h.CreateOrganization)).Methods("POST")
+	protected.Handle("/organizations", middleware.RequireScope(middleware.ScopeRead, h.ListOrganizations)).Methods("GET")
+	protected.Handle("/organizations/{id}/members", middleware.RequireScope(middleware.ScopeRead, h.ListOrganizationMembers)).Methods("GET")
+	protected.Handle("/organizations/{id}/members", middleware.RequireScope(middleware.ScopeWrite, h.AddOrganizationMember)).Methods("POST")
+	protected.Handle("/organizations/{id}/members/{user_id}", middleware.RequireScope(middleware.ScopeWrite, h.UpdateOrganizationMember)).Methods("PATCH")
+	protected.Handle("/organizations/{id}/members/{user_id}", middleware.RequireScope(middleware.ScopeDelete, h.RemoveOrganizationMember)).Methods("DELETE")
 
-	// Apply CORS middleware to all routes
-	handler := middleware.CORS(r)
+	// User roles and scopes, for admins
+	protected.Handle("/admin/users", middleware.RequireScope(middleware.ScopeAdmin, h.ListUsers)).Methods("GET")
+	protected.Handle("/admin/users/{id}/access", middleware.RequireScope(middleware.ScopeAdmin, h.UpdateUserAccess)).Methods("PUT")
+	protected.Handle("/admin/users/{id}/unlock", middleware.RequireScope(middleware.ScopeAdmin, h.UnlockUser)).Methods("POST")
+
+	// Audit log
+	protected.Handle("/audit", middleware.RequireScope(middleware.ScopeAdmin, h.ListAuditEvents)).Methods("GET")
+	protected.Handle("/me/audit", middleware.RequireScope(middleware.ScopeRead, h.ListMyAuditEvents)).Methods("GET")
+
+	// API keys for scripts and other machine clients
+	protected.HandleFunc("/api-keys", h.CreateAPIKey).Methods("POST")
+	protected.HandleFunc("/api-keys", h.ListAPIKeys).Methods("GET")
+	protected.HandleFunc("/api-keys/{id}", h.RevokeAPIKey).Methods("DELETE")
+
+	// TOTP multi-factor authentication
+	protected.HandleFunc("/mfa", h.GetMFAStatus).Methods("GET")
+	protected.HandleFunc("/mfa/enroll", h.EnrollMFA).Methods("POST")
+	protected.HandleFunc("/mfa/confirm", h.ConfirmMFA).Methods("POST")
+	protected.HandleFunc("/mfa", h.DisableMFA).Methods("DELETE")
+
+	// Your own account
+	protected.Handle("/me", middleware.RequireScope(middleware.ScopeRead, h.GetProfile)).Methods("GET")
+	protected.HandleFunc("/me", h.UpdateProfile).Methods("PATCH")
+	protected.HandleFunc("/me", h.DeleteAccount).Methods("DELETE")
+	protected.HandleFunc("/me/export", h.ExportAccount).Methods("GET")
+	protected.Handle("/me/usage", middleware.RequireScope(middleware.ScopeRead, h.GetUsage)).Methods("GET")
+
+	// Groups to share tables with
+	protected.Handle("/groups", middleware.RequireScope(middleware.ScopeWrite, h.CreateGroup)).Methods("POST")
+	protected.Handle("/groups", middleware.RequireScope(middleware.ScopeRead, h.ListGroups)).Methods("GET")
+	protected.Handle("/groups/{id}", middleware.RequireScope(middleware.ScopeDelete, h.DeleteGroup)).Methods("DELETE")
+	protected.Handle("/groups/{id}/members", middleware.RequireScope(middleware.ScopeWrite, h.AddGroupMember)).Methods("POST")
+	protected.Handle("/groups/{id}/members/{user_id}", middleware.RequireScope(middleware.ScopeDelete, h.RemoveGroupMember)).Methods("DELETE")
+
+	// Scheduled pipeline routes
+	protected.Handle("/pipelines", middleware.RequireScope(middleware.ScopeWrite, h.CreatePipeline)).Methods("POST")
+	protected.Handle("/pipelines", middleware.RequireScope(middleware.ScopeRead, h.ListPipelines)).Methods("GET")
+	protected.Handle("/pipelines/{id}", middleware.RequireScope(middleware.ScopeDelete, h.DeletePipeline)).Methods("DELETE")
+	protected.Handle("/pipelines/{id}/run", middleware.RequireScope(middleware.ScopeWrite, h.TriggerPipeline)).Methods("POST")
+	protected.Handle("/pipelines/{id}/runs", middleware.RequireScope(middleware.ScopeRead, h.ListPipelineRuns)).Methods("GET")
+
+	// Apply CORS middleware to all routes, and tag and log every request
+	handler := middleware.RequestID(middleware.AccessLog(middleware.CORS(r)))
 
 	// Get port from environment or default to 8080
 	port := os.Getenv("PORT")
@@ -57,11 +211,18 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("🚀 ETL API Server starting on port %s", port)
-	log.Printf("📊 Database connected and migrations complete")
-	log.Printf("🔐 JWT authentication enabled")
-	log.Printf("📁 File upload ready (max size: 10MB)")
+	slog.Info("ETL API Server starting",
+		"port", port,
+		"signing_key", utils.ActiveKeyID(),
+		"max_upload", "10MB",
+		"scheduler_interval", schedulerInterval.String())
 
 	// Start server
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	fatal("Server stopped", http.ListenAndServe(":"+port, handler))
+}
+
+// fatal logs why the server can't run and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
\ No newline at end of file
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Audit outcomes, from the response status
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+// AuditEvent is one audited request
+type AuditEvent struct {
+	UserID     string
+	Email      string
+	APIKeyID   string
+	Action     string
+	ResourceID string
+	IP         string
+	UserAgent  string
+	Status     int
+	Outcome    string
+}
+
+// AuditRecorder stores an audit event
+type AuditRecorder func(event AuditEvent) error
+
+var recordAudit AuditRecorder
+
+// UseAuditRecorder sets where Audit stores the events it records
+func UseAuditRecorder(rec AuditRecorder) {
+	recordAudit = rec
+}
+
+// auditEntry collects who made a request and what it touched while the request runs
+type auditEntry struct {
+	userID     string
+	email      string
+	apiKeyID   string
+	resourceID string
+	forget     bool
+}
+
+func getAuditEntry(r *http.Request) *auditEntry {
+	entry, _ := r.Context().Value("audit_entry").(*auditEntry)
+	return entry
+}
+
+// SetAuditUser records who a request acts for in the audit and access logs, for requests
+// that identify the user themselves, like logins. userID may be empty when only the email
+// is known.
+func SetAuditUser(r *http.Request, userID, email string) {
+	setLogUser(r, userID)
+	if entry := getAuditEntry(r); entry != nil {
+		entry.userID = userID
+		entry.email = email
+	}
+}
+
+// ForgetAuditUser leaves the email, IP address and user agent out of the request's audit
+// event, for requests that erase the user, like deleting the account
+func ForgetAuditUser(r *http.Request) {
+	if entry := getAuditEntry(r); entry != nil {
+		entry.email = ""
+		entry.forget = true
+	}
+}
+
+// SetAuditResource records the resource a request touched when the route doesn't name it,
+// like the table an upload creates
+func SetAuditResource(r *http.Request, resourceID string) {
+	if entry := getAuditEntry(r); entry != nil {
+		entry.resourceID = resourceID
+	}
+}
+
+// setAuditAPIKey records the API key a request was made with
+func setAuditAPIKey(r *http.Request, keyID string) {
+	if entry := getAuditEntry(r); entry != nil {
+		entry.apiKeyID = keyID
+	}
+}
+
+// statusRecorder remembers the status a handler responded with and how much it wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streamed responses reach the client as they are written
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// auditOutcome classifies a response status
+func auditOutcome(status int) string {
+	switch {
+	case status < 400:
+		return AuditSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return AuditDenied
+	}
+	return AuditFailure
+}
+
+// Audit records every request it wraps as an audit event once the response is written.
+// The action is the method and route, like "DELETE /tables/{id}", and the resource is the
+// route's table or id, unless the handler names one with SetAuditResource. Put it outside
+// JWTAuth so requests with rejected credentials are recorded too.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &auditEntry{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), "audit_entry", entry)))
+
+		if recordAudit == nil {
+			return
+		}
+
+		action := r.Method + " " + r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				action = r.Method + " " + template
+			}
+		}
+
+		resourceID := entry.resourceID
+		if resourceID == "" {
+			vars := mux.Vars(r)
+			resourceID = vars["table_id"]
+			if resourceID == "" {
+				resourceID = vars["id"]
+			}
+		}
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		event := AuditEvent{
+			UserID:     entry.userID,
+			Email:      entry.email,
+			APIKeyID:   entry.apiKeyID,
+			Action:     action,
+			ResourceID: resourceID,
+			IP:         GetClientIP(r),
+			UserAgent:  r.UserAgent(),
+			Status:     status,
+			Outcome:    auditOutcome(status),
+		}
+		if entry.forget {
+			event.IP = ""
+			event.UserAgent = ""
+		}
+		if err := recordAudit(event); err != nil {
+			Logger(r).Error("Failed to record audit event", "error", err, "action", action)
+		}
+	})
+}
@@ -7,7 +7,37 @@ import (
 	"strings"
 )
 
-// JWTAuth validates JWT tokens and adds user info to request context
+// SessionValidator reports whether the session a token was issued under is still active
+type SessionValidator func(sessionID, userID string) (bool, error)
+
+var validateSession SessionValidator
+
+// UseSessionValidator sets the check JWTAuth runs to reject tokens of revoked sessions
+func UseSessionValidator(v SessionValidator) {
+	validateSession = v
+}
+
+// APIKeyIdentity is who an API key acts as and what it may do
+type APIKeyIdentity struct {
+	KeyID       string
+	UserID      string
+	Email       string
+	WorkspaceID string
+	Scopes      []string
+}
+
+// APIKeyValidator looks up an API key, returning nil if it is unknown, revoked or expired
+type APIKeyValidator func(key string) (*APIKeyIdentity, error)
+
+var validateAPIKey APIKeyValidator
+
+// UseAPIKeyValidator sets the lookup JWTAuth uses for "Authorization: ApiKey" headers
+func UseAPIKeyValidator(v APIKeyValidator) {
+	validateAPIKey = v
+}
+
+// JWTAuth validates JWT tokens and adds user info to request context.
+// API keys sent as "Authorization: ApiKey <key>" are accepted too.
 func JWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -16,6 +46,11 @@ func JWTAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			apiKeyAuth(w, r, strings.TrimPrefix(authHeader, "ApiKey "), next)
+			return
+		}
+
 		// Check if header starts with "Bearer "
 		if !strings.HasPrefix(authHeader, "Bearer ") {
 			http.Error(w, `{"error": "Invalid authorization header format"}`, http.StatusUnauthorized)
@@ -31,20 +66,72 @@ func JWTAuth(next http.Handler) http.Handler {
 
 		// Validate token
 		claims, err := utils.ValidateToken(tokenString)
-		if err != nil {
+		if err != nil || claims.ID == "" {
 			http.Error(w, `{"error": "Invalid token"}`, http.StatusUnauthorized)
 			return
 		}
 
+		// Tokens stop working as soon as their session is logged out
+		if validateSession != nil {
+			active, err := validateSession(claims.ID, claims.UserID)
+			if err != nil {
+				Logger(r).Error("Failed to validate session", "error", err)
+				http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, `{"error": "Session has been revoked"}`, http.StatusUnauthorized)
+				return
+			}
+		}
+
 		// Add user info to request context
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "user_email", claims.Email)
+		ctx = context.WithValue(ctx, "workspace_id", claims.WorkspaceID)
+		ctx = context.WithValue(ctx, "session_id", claims.ID)
+		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx = context.WithValue(ctx, "scopes", claims.Scopes)
+
+		SetAuditUser(r, claims.UserID, claims.Email)
 
 		// Continue with authenticated request
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// apiKeyAuth authenticates a request made with an API key
+func apiKeyAuth(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	if key == "" || validateAPIKey == nil {
+		http.Error(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := validateAPIKey(key)
+	if err != nil {
+		Logger(r).Error("Failed to validate API key", "error", err)
+		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		return
+	}
+	if identity == nil {
+		http.Error(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// Add the key's owner and scopes to request context
+	ctx := context.WithValue(r.Context(), "user_id", identity.UserID)
+	ctx = context.WithValue(ctx, "user_email", identity.Email)
+	ctx = context.WithValue(ctx, "workspace_id", identity.WorkspaceID)
+	ctx = context.WithValue(ctx, "api_key_id", identity.KeyID)
+	if identity.Scopes != nil {
+		ctx = context.WithValue(ctx, "scopes", identity.Scopes)
+	}
+	SetAuditUser(r, identity.UserID, identity.Email)
+	setAuditAPIKey(r, identity.KeyID)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetUserIDFromContext extracts user ID from request context
 func GetUserIDFromContext(r *http.Request) string {
 	userID, ok := r.Context().Value("user_id").(string)
@@ -61,4 +148,31 @@ func GetUserEmailFromContext(r *http.Request) string {
 		return ""
 	}
 	return email
-}
\ No newline at end of file
+}
+
+// GetWorkspaceIDFromContext extracts the current workspace ID from request context
+func GetWorkspaceIDFromContext(r *http.Request) string {
+	workspaceID, ok := r.Context().Value("workspace_id").(string)
+	if !ok {
+		return ""
+	}
+	return workspaceID
+}
+
+// GetSessionIDFromContext extracts the session the token was issued under from request context
+func GetSessionIDFromContext(r *http.Request) string {
+	sessionID, ok := r.Context().Value("session_id").(string)
+	if !ok {
+		return ""
+	}
+	return sessionID
+}
+
+// GetAPIKeyIDFromContext extracts the API key a request was made with, if any, from request context
+func GetAPIKeyIDFromContext(r *http.Request) string {
+	keyID, ok := r.Context().Value("api_key_id").(string)
+	if !ok {
+		return ""
+	}
+	return keyID
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// trustProxyHeaders reports whether the server runs behind a proxy that sets
+// X-Forwarded-For, from TRUST_PROXY_HEADERS
+func trustProxyHeaders() bool {
+	switch strings.ToLower(os.Getenv("TRUST_PROXY_HEADERS")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// GetClientIP returns the address a request came from. Behind a trusted proxy it is the
+// last X-Forwarded-For entry, the one the proxy itself added; earlier entries come from
+// the client and can't be trusted.
+func GetClientIP(r *http.Request) string {
+	if trustProxyHeaders() {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,25 +1,193 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
-// CORS adds Cross-Origin Resource Sharing headers
-func CORS(next http.Handler) http.Handler {
+// CORSConfig is which browser origins may call the API and what they may send and read
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSConfigFromEnv reads CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS,
+// CORS_EXPOSED_HEADERS, CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE. No origins are allowed
+// unless listed.
+func CORSConfigFromEnv() CORSConfig {
+	config := CORSConfig{
+		AllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"},
+		ExposedHeaders: []string{"Content-Disposition", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+	if methods := splitList(os.Getenv("CORS_ALLOWED_METHODS")); methods != nil {
+		config.AllowedMethods = methods
+	}
+	if headers := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); headers != nil {
+		config.AllowedHeaders = headers
+	}
+	if headers := splitList(os.Getenv("CORS_EXPOSED_HEADERS")); headers != nil {
+		config.ExposedHeaders = headers
+	}
+	switch strings.ToLower(os.Getenv("CORS_ALLOW_CREDENTIALS")) {
+	case "1", "true", "yes", "on":
+		config.AllowCredentials = true
+	}
+	if d, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil && d >= 0 {
+		config.MaxAge = d
+	}
+
+	for i, method := range config.AllowedMethods {
+		config.AllowedMethods[i] = strings.ToUpper(method)
+	}
+	for i, origin := range config.AllowedOrigins {
+		config.AllowedOrigins[i] = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	}
+	return config
+}
+
+// splitList splits a comma-separated setting, or returns nil if it is empty
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// originAllowed reports whether an origin matches one of the allowed origins. A pattern
+// like https://*.example.com matches any subdomain, but not example.com itself.
+func (c CORSConfig) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if !wildcard || !strings.HasPrefix(suffix, ".") {
+			continue
+		}
+		if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+		subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+		if strings.Trim(subdomain, "abcdefghijklmnopqrstuvwxyz0123456789-.") == "" &&
+			!strings.HasPrefix(subdomain, ".") && !strings.HasSuffix(subdomain, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// methodAllowed reports whether cross-origin requests may use the method
+func (c CORSConfig) methodAllowed(method string) bool {
+	for _, allowed := range c.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS adds Cross-Origin Resource Sharing headers for the configured origins and answers
+// preflight requests for the router's routes. Requests from other origins are served
+// without CORS headers, so browsers keep their responses from the calling page.
+func CORS(router *mux.Router) http.Handler {
+	config := CORSConfigFromEnv()
+	anyOrigin := false
+	for _, origin := range config.AllowedOrigins {
+		anyOrigin = anyOrigin || origin == "*"
+	}
+	if anyOrigin && config.AllowCredentials {
+		slog.Warn("Ignoring CORS_ALLOW_CREDENTIALS because CORS_ALLOWED_ORIGINS allows any origin")
+		config.AllowCredentials = false
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		// The answer depends on the origin, so caches must keep one per origin
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			router.ServeHTTP(w, r)
+			return
+		}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		allowed := config.originAllowed(origin)
+
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && requestedMethod != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			preflight(w, r, router, config, allowed, anyOrigin, origin, requestedMethod)
 			return
 		}
 
-		// Continue with the request
-		next.ServeHTTP(w, r)
+		if allowed {
+			setAllowOrigin(w, config, anyOrigin, origin)
+			if len(config.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+			}
+		}
+
+		router.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// preflight answers a browser asking whether it may send a cross-origin request, but
+// only for an allowed origin and a method and route that exist
+func preflight(w http.ResponseWriter, r *http.Request, router *mux.Router, config CORSConfig, allowed, anyOrigin bool, origin, method string) {
+	if !allowed {
+		http.Error(w, `{"error": "Origin not allowed"}`, http.StatusForbidden)
+		return
+	}
+
+	probe := r.Clone(r.Context())
+	probe.Method = method
+	var match mux.RouteMatch
+	if !router.Match(probe, &match) {
+		if match.MatchErr == mux.ErrMethodMismatch {
+			http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		http.Error(w, `{"error": "Not found"}`, http.StatusNotFound)
+		return
+	}
+	if !config.methodAllowed(method) {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	setAllowOrigin(w, config, anyOrigin, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setAllowOrigin names the origin the response may be read by
+func setAllowOrigin(w http.ResponseWriter, config CORSConfig, anyOrigin bool, origin string) {
+	if anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
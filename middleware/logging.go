@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// maxRequestIDLength bounds request IDs taken from clients, which end up in every log line
+const maxRequestIDLength = 128
+
+// requestLog collects what the access log reports about a request that is only known
+// further in, like the user
+type requestLog struct {
+	userID string
+}
+
+// setLogUser records the user a request acts for in its access log line
+func setLogUser(r *http.Request, userID string) {
+	if entry, ok := r.Context().Value("request_log").(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID tags each request with the X-Request-ID a proxy or client sent, or a new one,
+// and returns it in the response so a request can be traced through the logs
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestIDFromContext extracts the request ID from request context
+func GetRequestIDFromContext(r *http.Request) string {
+	id, ok := r.Context().Value("request_id").(string)
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// Logger returns the logger for a request, which tags every line with its request ID and user
+func Logger(r *http.Request) *slog.Logger {
+	logger := slog.Default()
+	if id := GetRequestIDFromContext(r); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if userID := GetUserIDFromContext(r); userID != "" {
+		logger = logger.With("user_id", userID)
+	}
+	return logger
+}
+
+// AccessLog logs one line per request once it is answered: method, path, status, latency,
+// response size, user and client. Put it inside RequestID.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), "request_log", entry)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+
+		slog.Default().LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", GetRequestIDFromContext(r)),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("user_id", entry.userID),
+			slog.String("ip", GetClientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Rate limit budgets; each has its own bucket per user or client IP
+const (
+	BudgetAuth   = "auth"
+	BudgetUpload = "upload"
+	BudgetRead   = "read"
+	BudgetWrite  = "write"
+	BudgetClient = "client"
+)
+
+// RateLimit is a token bucket: it holds Requests tokens and refills them evenly over Per.
+// A zero RateLimit means no limit.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// RateLimitResult is the outcome of taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// defaultRateLimits apply when the budget's RATE_LIMIT_* variable is unset
+var defaultRateLimits = map[string]RateLimit{
+	BudgetAuth:   {Requests: 20, Per: time.Minute},
+	BudgetUpload: {Requests: 60, Per: time.Hour},
+	BudgetRead:   {Requests: 600, Per: time.Minute},
+	BudgetWrite:  {Requests: 120, Per: time.Minute},
+	BudgetClient: {Requests: 1200, Per: time.Minute},
+}
+
+// RateLimitFromEnv reads a budget's limit from RATE_LIMIT_AUTH, RATE_LIMIT_UPLOAD,
+// RATE_LIMIT_READ, RATE_LIMIT_WRITE or RATE_LIMIT_CLIENT, written like 20/1m; "off" turns the limit off
+func RateLimitFromEnv(budget string) RateLimit {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("RATE_LIMIT_" + strings.ToUpper(budget))))
+	switch value {
+	case "":
+		return defaultRateLimits[budget]
+	case "0", "off", "false", "no":
+		return RateLimit{}
+	}
+
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid rate limit", "variable", "RATE_LIMIT_"+strings.ToUpper(budget), "error", err)
+		return defaultRateLimits[budget]
+	}
+	return limit
+}
+
+// ParseRateLimit parses a limit like 20/1m or 1000/h: requests per duration
+func ParseRateLimit(s string) (RateLimit, error) {
+	requestsStr, perStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like 20/1m", s)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(requestsStr))
+	if err != nil || requests <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid request count in rate limit %q", s)
+	}
+	perStr = strings.TrimSpace(perStr)
+	if perStr != "" && strings.Trim(perStr, "hms") == "" {
+		perStr = "1" + perStr
+	}
+	per, err := time.ParseDuration(perStr)
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period in rate limit %q", s)
+	}
+	return RateLimit{Requests: requests, Per: per}, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// Spend takes a token from a bucket that holds tokens after refilling, returning what is
+// left in it and the outcome. Stores call it with their bucket's state.
+func (l RateLimit) Spend(tokens float64) (float64, RateLimitResult) {
+	perToken := l.Per.Seconds() / float64(l.Requests)
+	tokens = math.Min(tokens, float64(l.Requests))
+
+	result := RateLimitResult{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * perToken * float64(time.Second))
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((float64(l.Requests) - tokens) * perToken * float64(time.Second))
+	return tokens, result
+}
+
+// Refill returns how many tokens a bucket holds after elapsed time
+func (l RateLimit) Refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Requests), tokens+elapsed.Seconds()*float64(l.Requests)/l.Per.Seconds())
+}
+
+// RateLimitStore takes a token from the bucket stored under key
+type RateLimitStore func(key string, limit RateLimit) (RateLimitResult, error)
+
+var rateLimitStore RateLimitStore = newMemoryRateLimitStore().take
+
+// UseRateLimitStore replaces the in-memory buckets, e.g. with buckets shared by every
+// instance of the server
+func UseRateLimitStore(store RateLimitStore) {
+	rateLimitStore = store
+}
+
+// memoryBucket is one token bucket kept in memory
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// memoryRateLimitStore keeps buckets in this process, so each instance limits separately
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// memorySweepEvery is how many takes pass between sweeps of idle buckets
+const memorySweepEvery = 10000
+
+func (s *memoryRateLimitStore) take(key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = bucket
+	}
+
+	tokens, result := limit.Spend(limit.Refill(bucket.tokens, now.Sub(bucket.updated)))
+	bucket.tokens, bucket.updated = tokens, now
+
+	// Buckets idle for a day have long refilled, so forgetting them changes nothing
+	s.takes++
+	if s.takes >= memorySweepEvery {
+		s.takes = 0
+		for k, b := range s.buckets {
+			if now.Sub(b.updated) > 24*time.Hour {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// requestBudget picks the budget a request is counted against
+func requestBudget(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/auth/") {
+		return BudgetAuth
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil && template == "/upload" {
+			return BudgetUpload
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return BudgetRead
+	}
+	return BudgetWrite
+}
+
+// RateLimitClients limits every request per client IP, whoever it claims to be. Put it
+// before JWTAuth so requests with invalid credentials are limited before they're refused.
+func RateLimitClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitRequest(w, r, BudgetClient, BudgetClient+":ip:"+GetClientIP(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// RateLimitRequests limits requests per user, or per client IP when there is no user yet,
+// with separate budgets for auth endpoints, uploads, reads and writes. Put it after
+// JWTAuth so authenticated requests count against the user wherever they come from.
+func RateLimitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := requestBudget(r)
+		key := budget + ":ip:" + GetClientIP(r)
+		if userID := GetUserIDFromContext(r); userID != "" {
+			key = budget + ":user:" + userID
+		}
+
+		if limitRequest(w, r, budget, key) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// limitRequest takes a token from the budget's bucket under key and reports whether the
+// request may go on; when it may not, the 429 has already been written
+func limitRequest(w http.ResponseWriter, r *http.Request, budget, key string) bool {
+	limit := RateLimitFromEnv(budget)
+	if !limit.Enabled() {
+		return true
+	}
+
+	// Failing open keeps the API up when the store is down
+	result, err := rateLimitStore(key, limit)
+	if err != nil {
+		Logger(r).Error("Failed to check rate limit", "error", err, "budget", budget)
+		return true
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Rate limit exceeded; try again later"}`, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
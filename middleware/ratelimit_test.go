@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitClientsBeforeAuth(t *testing.T) {
+	t.Setenv("RATE_LIMIT_CLIENT", "3/1m")
+	t.Setenv("TRUST_PROXY_HEADERS", "")
+	UseRateLimitStore(newMemoryRateLimitStore().take)
+	t.Cleanup(func() { UseRateLimitStore(newMemoryRateLimitStore().take) })
+
+	handler := RateLimitClients(JWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a request with an invalid token reached the handler")
+	})))
+
+	request := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/tables", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer not-a-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := request("203.0.113.7:40000"); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := request("203.0.113.7:40001"); code != http.StatusTooManyRequests {
+		t.Errorf("request over the limit: got %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Other clients keep their own bucket
+	if code := request("198.51.100.2:40000"); code != http.StatusUnauthorized {
+		t.Errorf("request from another IP: got %d, want %d", code, http.StatusUnauthorized)
+	}
+}
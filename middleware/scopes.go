@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// Scopes limit what a credential may do
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopeUpload, ScopeWrite, ScopeDelete, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// GetRoleFromContext extracts the user's role from request context
+func GetRoleFromContext(r *http.Request) string {
+	role, ok := r.Context().Value("role").(string)
+	if !ok {
+		return ""
+	}
+	return role
+}
+
+// GetScopesFromContext returns the scopes the request's credential carries
+func GetScopesFromContext(r *http.Request) []string {
+	scopes, ok := r.Context().Value("scopes").([]string)
+	if !ok {
+		return nil
+	}
+	return scopes
+}
+
+// HasScope reports whether the request's credential carries the scope. A request
+// without scopes in its context has none.
+func HasScope(r *http.Request, scope string) bool {
+	for _, s := range GetScopesFromContext(r) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope only lets requests through whose credential carries the scope
+func RequireScope(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasScope(r, scope) {
+			http.Error(w, `{"error": "Credential is missing the `+scope+` scope"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
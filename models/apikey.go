@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// APIKey is a named credential a user creates for scripts and other machine clients
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	WorkspaceID *string    `json:"workspace_id,omitempty"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest represents the payload to create an API key.
+// No scopes gives the key every scope.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse returns a new API key; the key itself is only ever shown here
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyListResponse represents the list of a user's API keys
+type APIKeyListResponse struct {
+	Keys  []APIKey `json:"keys"`
+	Total int      `json:"total"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AuditEvent records one request: who made it, what it did, and how it ended
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	UserID     *string   `json:"user_id"`
+	Email      *string   `json:"email"`
+	APIKeyID   *string   `json:"api_key_id,omitempty"`
+	Action     string    `json:"action"`
+	ResourceID *string   `json:"resource_id"`
+	IP         *string   `json:"ip"`
+	UserAgent  *string   `json:"user_agent"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+}
+
+// AuditEventListResponse represents a page of audit events, newest first. Pass
+// next_before as ?before= to get the next page.
+type AuditEventListResponse struct {
+	Events     []AuditEvent `json:"events"`
+	NextBefore *int64       `json:"next_before,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// JWK is the public half of a signing key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
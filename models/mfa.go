@@ -0,0 +1,37 @@
+package models
+
+// MFAEnrollResponse returns a new TOTP secret; scan the provisioning URI as a QR code
+// or type the secret into an authenticator app
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest represents a code from the authenticator app, or a recovery code
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFARecoveryCodesResponse returns recovery codes; they are only ever shown here
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAStatusResponse represents whether a user has MFA turned on
+type MFAStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the user has MFA turned on
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// MFALoginRequest exchanges an MFA challenge token and a code for access and refresh tokens
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
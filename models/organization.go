@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Organization is a workspace whose members share its tables
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	Role      string    `json:"role"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationMember represents a user's membership and role in an organization
+type OrganizationMember struct {
+	UserID  string    `json:"user_id"`
+	Email   string    `json:"email"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// CreateOrganizationRequest represents the organization creation payload
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// AddOrganizationMemberRequest represents the payload to add a user to an organization
+type AddOrganizationMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// UpdateOrganizationMemberRequest represents the payload to change a member's role
+type UpdateOrganizationMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// OrganizationListResponse represents the organizations a user belongs to
+type OrganizationListResponse struct {
+	Organizations []Organization `json:"organizations"`
+	Total         int            `json:"total"`
+}
+
+// OrganizationMemberListResponse represents the members of an organization
+type OrganizationMemberListResponse struct {
+	OrganizationID string               `json:"organization_id"`
+	Members        []OrganizationMember `json:"members"`
+}
+
+// SwitchWorkspaceRequest represents the payload to change the current workspace
+type SwitchWorkspaceRequest struct {
+	WorkspaceID string `json:"workspace_id"`
+}
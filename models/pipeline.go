@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Pipeline represents a scheduled pull of CSV files into a table
+type Pipeline struct {
+	ID             string     `json:"id" db:"id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	Name           string     `json:"name" db:"name"`
+	TableName      string     `json:"table_name" db:"table_name"`
+	TableID        *string    `json:"table_id" db:"table_id"`
+	SourceType     string     `json:"source_type" db:"source_type"`
+	Source         string     `json:"source" db:"source"`
+	Pattern        string     `json:"pattern" db:"pattern"`
+	Schedule       string     `json:"schedule" db:"schedule"`
+	LoadMode       string     `json:"load_mode" db:"load_mode"`
+	Enabled        bool       `json:"enabled" db:"enabled"`
+	LastRunAt      *time.Time `json:"last_run_at" db:"last_run_at"`
+	NextRunAt      *time.Time `json:"next_run_at" db:"next_run_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreatePipelineRequest represents pipeline creation payload
+type CreatePipelineRequest struct {
+	Name       string `json:"name"`
+	TableName  string `json:"table_name"`
+	SourceType string `json:"source_type"`
+	Source     string `json:"source"`
+	Pattern    string `json:"pattern"`
+	Schedule   string `json:"schedule"`
+	LoadMode   string `json:"load_mode"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+// PipelineListResponse represents response for listing pipelines
+type PipelineListResponse struct {
+	Pipelines []Pipeline `json:"pipelines"`
+	Total     int        `json:"total"`
+}
+
+// PipelineRun records a single execution of a pipeline
+type PipelineRun struct {
+	ID            string     `json:"id" db:"id"`
+	PipelineID    string     `json:"pipeline_id" db:"pipeline_id"`
+	Trigger       string     `json:"trigger" db:"trigger"`
+	Status        string     `json:"status" db:"status"`
+	FilesIngested int        `json:"files_ingested" db:"files_ingested"`
+	FilesSkipped  int        `json:"files_skipped" db:"files_skipped"`
+	RowsImported  int        `json:"rows_imported" db:"rows_imported"`
+	ErrorMessage  *string    `json:"error_message" db:"error_message"`
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+// PipelineRunListResponse represents response for listing pipeline runs
+type PipelineRunListResponse struct {
+	Runs  []PipelineRun `json:"runs"`
+	Total int           `json:"total"`
+}
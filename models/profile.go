@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Profile represents the authenticated user's own account
+type Profile struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	DisplayName   string    `json:"display_name"`
+	Role          string    `json:"role"`
+	Scopes        []string  `json:"scopes"`
+	EmailVerified bool      `json:"email_verified"`
+	HasPassword   bool      `json:"has_password"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	WorkspaceID   string    `json:"workspace_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// UpdateProfileRequest represents changes to the user's own account; omitted fields stay
+// the same. Changing the email needs the current password, if the account has one.
+type UpdateProfileRequest struct {
+	DisplayName     *string `json:"display_name"`
+	Email           *string `json:"email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// DeleteAccountRequest confirms deleting the user's own account with their password and,
+// when MFA is on, a code
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// DeleteAccountResponse reports what deleting an account removed
+type DeleteAccountResponse struct {
+	Message           string `json:"message"`
+	TablesDeleted     int    `json:"tables_deleted"`
+	TablesTransferred int    `json:"tables_transferred"`
+	WorkspacesDeleted int    `json:"workspaces_deleted"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// RowResponse represents a single row of an uploaded table
+type RowResponse struct {
+	TableID  string                 `json:"table_id"`
+	RowID    int64                  `json:"row_id"`
+	Row      map[string]interface{} `json:"row,omitempty"`
+	RowCount int                    `json:"row_count"`
+	Message  string                 `json:"message"`
+}
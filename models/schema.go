@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// SchemaPolicy decides how a table reacts to files whose headers changed
+type SchemaPolicy struct {
+	NewColumns     string `json:"new_columns"`
+	MissingColumns string `json:"missing_columns"`
+}
+
+// SchemaChange describes a single change applied to a table's schema
+type SchemaChange struct {
+	Action string `json:"action"`
+	Column string `json:"column"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// SchemaVersion is a snapshot of a table's schema after a set of changes
+type SchemaVersion struct {
+	Version     int                    `json:"version"`
+	TableSchema map[string]interface{} `json:"table_schema"`
+	Changes     []SchemaChange         `json:"changes"`
+	Filename    *string                `json:"filename"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// SchemaHistoryResponse represents the schema version history of a table
+type SchemaHistoryResponse struct {
+	TableID        string          `json:"table_id"`
+	CurrentVersion int             `json:"current_version"`
+	Policy         SchemaPolicy    `json:"policy"`
+	Versions       []SchemaVersion `json:"versions"`
+}
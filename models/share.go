@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// TableShare grants a user or a group access to a table
+type TableShare struct {
+	ID         string    `json:"id"`
+	TableID    string    `json:"table_id"`
+	UserID     *string   `json:"user_id,omitempty"`
+	UserEmail  *string   `json:"user_email,omitempty"`
+	GroupID    *string   `json:"group_id,omitempty"`
+	GroupName  *string   `json:"group_name,omitempty"`
+	Permission string    `json:"permission"`
+	CreatedBy  *string   `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ShareTableRequest represents the payload to share a table with a user or group
+type ShareTableRequest struct {
+	Email      string `json:"email"`
+	GroupID    string `json:"group_id"`
+	Permission string `json:"permission"`
+}
+
+// TableShareListResponse represents the list of shares of a table
+type TableShareListResponse struct {
+	TableID string       `json:"table_id"`
+	Shares  []TableShare `json:"shares"`
+}
+
+// Group is a named set of users tables can be shared with
+type Group struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	OwnerID   string        `json:"owner_id"`
+	Members   []GroupMember `json:"members"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// GroupMember represents a user belonging to a group
+type GroupMember struct {
+	UserID  string    `json:"user_id"`
+	Email   string    `json:"email"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// CreateGroupRequest represents the group creation payload
+type CreateGroupRequest struct {
+	Name string `json:"name"`
+}
+
+// AddGroupMemberRequest represents the payload to add a user to a group
+type AddGroupMemberRequest struct {
+	Email string `json:"email"`
+}
+
+// GroupListResponse represents the groups a user owns or belongs to
+type GroupListResponse struct {
+	Groups []Group `json:"groups"`
+	Total  int     `json:"total"`
+}
@@ -14,17 +14,22 @@ type DataTable struct {
 	RowCount          int                    `json:"row_count" db:"row_count"`
 	TableSchema       map[string]interface{} `json:"table_schema" db:"table_schema"`
 	PhysicalTableName string                 `json:"physical_table_name" db:"physical_table_name"`
+	Description       *string                `json:"description" db:"description"`
 	CreatedAt         time.Time              `json:"created_at" db:"created_at"`
 }
 
 // UploadResponse represents file upload response
 type UploadResponse struct {
-	TableID   string   `json:"table_id"`
-	TableName string   `json:"table_name"`
-	Filename  string   `json:"filename"`
-	RowsImported int   `json:"rows_imported"`
-	Columns   []string `json:"columns"`
-	Message   string   `json:"message"`
+	TableID         string            `json:"table_id"`
+	TableName       string            `json:"table_name"`
+	Filename        string            `json:"filename"`
+	RowsImported    int               `json:"rows_imported"`
+	RowsQuarantined int               `json:"rows_quarantined,omitempty"`
+	Columns         []string          `json:"columns"`
+	Validation      *ValidationReport `json:"validation,omitempty"`
+	SchemaChanges   []SchemaChange    `json:"schema_changes,omitempty"`
+	Version         int               `json:"version"`
+	Message         string            `json:"message"`
 }
 
 // TableListResponse represents response for listing tables
@@ -37,9 +42,12 @@ type TableListResponse struct {
 type DataTableSummary struct {
 	ID               string    `json:"id"`
 	Name             string    `json:"name"`
+	Description      *string   `json:"description"`
 	Filename         string    `json:"filename"`
 	Rows             int       `json:"rows"`
 	Columns          int       `json:"columns"`
+	Shared           bool      `json:"shared"`
+	Permission       string    `json:"permission"`
 	CreatedAt        time.Time `json:"created_at"`
 }
 
@@ -47,6 +55,7 @@ type DataTableSummary struct {
 type DataResponse struct {
 	TableInfo  DataTableInfo            `json:"table_info"`
 	Data       []map[string]interface{} `json:"data"`
+	RowIDs     []int64                  `json:"row_ids"`
 	Pagination PaginationInfo           `json:"pagination"`
 }
 
@@ -56,6 +65,7 @@ type DataTableInfo struct {
 	Name       string   `json:"name"`
 	TotalRows  int      `json:"total_rows"`
 	Columns    []string `json:"columns"`
+	Version    int      `json:"version"`
 }
 
 // PaginationInfo represents pagination information
@@ -64,4 +74,25 @@ type PaginationInfo struct {
 	PerPage     int  `json:"per_page"`
 	TotalPages  int  `json:"total_pages"`
 	HasNext     bool `json:"has_next"`
+}
+
+// UpdateTableRequest represents table rename payload
+type UpdateTableRequest struct {
+	TableName   *string `json:"table_name"`
+	Description *string `json:"description"`
+}
+
+// UpdateColumnRequest represents column rename / type change payload
+type UpdateColumnRequest struct {
+	Name *string `json:"name"`
+	Type *string `json:"type"`
+}
+
+// ColumnChangeResponse represents the schema of a table after a column change
+type ColumnChangeResponse struct {
+	TableID       string                 `json:"table_id"`
+	TableSchema   map[string]interface{} `json:"table_schema"`
+	SchemaVersion int                    `json:"schema_version"`
+	Changes       []SchemaChange         `json:"changes"`
+	Message       string                 `json:"message"`
 }
\ No newline at end of file
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// TrashedTable represents a deleted table waiting to be purged
+type TrashedTable struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Filename  string    `json:"filename"`
+	Rows      int       `json:"rows"`
+	Columns   int       `json:"columns"`
+	CreatedAt time.Time `json:"created_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// TrashListResponse represents the trash listing response
+type TrashListResponse struct {
+	Tables []TrashedTable `json:"tables"`
+	Total  int            `json:"total"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// Usage reports the storage a user or workspace uses against its quota
+type Usage struct {
+	Scope       string      `json:"scope"`
+	WorkspaceID string      `json:"workspace_id,omitempty"`
+	Tables      int64       `json:"tables"`
+	Rows        int64       `json:"rows"`
+	Bytes       int64       `json:"bytes"`
+	Limits      UsageLimits `json:"limits"`
+}
+
+// UsageLimits holds the quota limits; null means unlimited
+type UsageLimits struct {
+	Tables *int64 `json:"tables"`
+	Rows   *int64 `json:"rows"`
+	Bytes  *int64 `json:"bytes"`
+}
@@ -9,14 +9,17 @@ type User struct {
 	ID           string    `json:"id" db:"id"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         string    `json:"role" db:"role"`
+	Scopes       []string  `json:"scopes,omitempty" db:"scopes"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // LoginRequest represents login request payload
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	WorkspaceID string `json:"workspace_id"`
 }
 
 // RegisterRequest represents registration request payload
@@ -25,8 +28,52 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+// UpdateUserAccessRequest represents an admin's change to a user's role and scopes.
+// Scopes narrow what the role allows; null restores the role's full set.
+type UpdateUserAccessRequest struct {
+	Role   string    `json:"role"`
+	Scopes *[]string `json:"scopes"`
+}
+
+// UserListResponse represents the list of users shown to admins
+type UserListResponse struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+}
+
+// EmailRequest represents a request that only names an account's email
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// VerifyEmailRequest represents an email verification token sent back by the user
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ResetPasswordRequest represents a password reset token with the new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest represents a logged-in user's password change
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for new tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // AuthResponse represents authentication response
 type AuthResponse struct {
-	Token     string `json:"token"`
-	ExpiresIn int    `json:"expires_in"`
+	Token        string   `json:"token"`
+	ExpiresIn    int      `json:"expires_in"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	WorkspaceID  string   `json:"workspace_id"`
+	Role         string   `json:"role"`
+	Scopes       []string `json:"scopes"`
 }
\ No newline at end of file
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// ValidationRules is the data contract attached to a table
+type ValidationRules struct {
+	OnFailure       string                `json:"on_failure"`
+	RequiredColumns []string              `json:"required_columns,omitempty"`
+	Columns         map[string]ColumnRule `json:"columns,omitempty"`
+	CrossColumn     []CrossColumnRule     `json:"cross_column,omitempty"`
+	MinRows         *int                  `json:"min_rows,omitempty"`
+	MaxRows         *int                  `json:"max_rows,omitempty"`
+}
+
+// ColumnRule holds the checks applied to every value of a column
+type ColumnRule struct {
+	NotNull bool     `json:"not_null,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// CrossColumnRule compares two columns of the same row, e.g. end_date >= start_date
+type CrossColumnRule struct {
+	Left     string `json:"left"`
+	Operator string `json:"operator"`
+	Right    string `json:"right"`
+}
+
+// ValidationReport describes the outcome of checking a file against the rules
+type ValidationReport struct {
+	Filename    string         `json:"filename"`
+	Action      string         `json:"action"`
+	TotalRows   int            `json:"total_rows"`
+	ValidRows   int            `json:"valid_rows"`
+	InvalidRows int            `json:"invalid_rows"`
+	TableErrors []string       `json:"table_errors"`
+	RowErrors   []RowViolation `json:"row_errors"`
+	Truncated   bool           `json:"truncated"`
+	CheckedAt   time.Time      `json:"checked_at"`
+}
+
+// RowViolation describes a single failed check on a data row
+type RowViolation struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// QuarantinedRow is a row held back from a table because it failed validation
+type QuarantinedRow struct {
+	ID        string                 `json:"id"`
+	RowNumber int                    `json:"row_number"`
+	Filename  string                 `json:"filename"`
+	Data      map[string]interface{} `json:"data"`
+	Errors    []RowViolation         `json:"errors"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ValidationStatusResponse represents the latest report and quarantined rows of a table
+type ValidationStatusResponse struct {
+	Rules       *ValidationRules  `json:"rules"`
+	Report      *ValidationReport `json:"report"`
+	Quarantined []QuarantinedRow  `json:"quarantined"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// TableVersion describes one load or rollback of a table
+type TableVersion struct {
+	Version          int       `json:"version"`
+	Operation        string    `json:"operation"`
+	OriginalFilename *string   `json:"original_filename"`
+	RowCount         int       `json:"row_count"`
+	ColumnCount      int       `json:"column_count"`
+	RolledBackTo     *int      `json:"rolled_back_to,omitempty"`
+	CreatedBy        *string   `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
+	IsCurrent        bool      `json:"is_current"`
+}
+
+// TableVersionListResponse represents response for listing table versions
+type TableVersionListResponse struct {
+	TableID        string         `json:"table_id"`
+	CurrentVersion int            `json:"current_version"`
+	Versions       []TableVersion `json:"versions"`
+}
+
+// RollbackRequest represents table rollback payload
+type RollbackRequest struct {
+	Version int `json:"version"`
+}
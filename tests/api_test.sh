@@ -5,7 +5,7 @@
 
 BASE_URL="http://localhost:8080"
 EMAIL="test@example.com"
-PASSWORD="testpassword123"
+PASSWORD="Lantern-Fjord-93"
 
 echo "🧪 ETL API Test Suite"
 echo "====================="
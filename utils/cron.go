@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule represents a parsed five-field cron expression
+type CronSchedule struct {
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	anyDay   bool
+	anyDow   bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard cron expression (minute hour day month weekday)
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields")
+	}
+
+	schedule := &CronSchedule{
+		anyDay: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+
+	if err := parseCronField(fields[0], 0, 59, schedule.minutes[:]); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %v", err)
+	}
+	if err := parseCronField(fields[1], 0, 23, schedule.hours[:]); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %v", err)
+	}
+	if err := parseCronField(fields[2], 1, 31, schedule.days[:]); err != nil {
+		return nil, fmt.Errorf("invalid day field: %v", err)
+	}
+	if err := parseCronField(fields[3], 1, 12, schedule.months[:]); err != nil {
+		return nil, fmt.Errorf("invalid month field: %v", err)
+	}
+
+	// Weekday accepts 0-7 where both 0 and 7 mean Sunday
+	var weekdays [8]bool
+	if err := parseCronField(fields[4], 0, 7, weekdays[:]); err != nil {
+		return nil, fmt.Errorf("invalid weekday field: %v", err)
+	}
+	copy(schedule.weekdays[:], weekdays[:7])
+	if weekdays[7] {
+		schedule.weekdays[0] = true
+	}
+
+	return schedule, nil
+}
+
+// parseCronField fills set with the values matched by a single cron field
+func parseCronField(field string, min, max int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return fmt.Errorf("invalid step %q", part[idx+1:])
+			}
+			step = s
+			part = part[:idx]
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			lo, err1 := strconv.Atoi(bounds[0])
+			hi, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("invalid range %q", part)
+			}
+			start, end = lo, hi
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return fmt.Errorf("invalid value %q", part)
+			}
+			start = v
+			if step == 1 {
+				end = v
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return fmt.Errorf("value out of range %d-%d", min, max)
+		}
+
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+
+	return nil
+}
+
+// Next returns the first time after t that matches the schedule
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Give up after five years to avoid looping forever on impossible dates
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.months[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches applies cron's day-of-month / day-of-week semantics
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dayMatch := s.days[t.Day()]
+	dowMatch := s.weekdays[t.Weekday()]
+
+	switch {
+	case s.anyDay && s.anyDow:
+		return true
+	case s.anyDay:
+		return dowMatch
+	case s.anyDow:
+		return dayMatch
+	default:
+		return dayMatch || dowMatch
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	from := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	for expr, want := range map[string]time.Time{
+		"*/15 * * * *": time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC),
+		"0 2 * * *":    time.Date(2025, 1, 16, 2, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":   time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 30 2 *":   {},
+		"0 0 31 4 *":   {},
+	} {
+		schedule, err := ParseCron(expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", expr, err)
+		}
+		if got := schedule.Next(from); !got.Equal(want) {
+			t.Errorf("%q: Next = %v, want %v", expr, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
@@ -182,6 +183,12 @@ func inferColumnType(rows [][]string, columnIndex int) string {
 
 // isDateString checks if a string could be a date
 func isDateString(value string) bool {
+	_, ok := parseDate(value)
+	return ok
+}
+
+// parseDate parses a value using the date formats recognised by type inference
+func parseDate(value string) (time.Time, bool) {
 	dateFormats := []string{
 		"2006-01-02",
 		"01/02/2006",
@@ -194,10 +201,67 @@ func isDateString(value string) bool {
 	}
 
 	for _, format := range dateFormats {
-		if _, err := time.Parse(format, value); err == nil {
-			return true
+		if t, err := time.Parse(format, value); err == nil {
+			return t, true
 		}
 	}
 
-	return false
+	return time.Time{}, false
+}
+
+// CoerceValue checks a JSON value against a column type and converts it to
+// the form stored in PostgreSQL. nil is passed through as NULL.
+func CoerceValue(dataType string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if n, ok := value.(json.Number); ok {
+		value = string(n)
+	}
+
+	switch strings.ToUpper(dataType) {
+	case "INTEGER":
+		switch v := value.(type) {
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("expected an integer")
+			}
+			return int64(v), nil
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer")
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("expected an integer")
+	case "NUMERIC":
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case string:
+			if _, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return nil, fmt.Errorf("expected a number")
+			}
+			return strings.TrimSpace(v), nil
+		}
+		return nil, fmt.Errorf("expected a number")
+	case "DATE":
+		if v, ok := value.(string); ok {
+			if t, ok := parseDate(strings.TrimSpace(v)); ok {
+				return t.Format("2006-01-02"), nil
+			}
+		}
+		return nil, fmt.Errorf("expected a date")
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, fmt.Errorf("expected a text value")
+	}
 }
\ No newline at end of file
@@ -8,38 +8,52 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
-
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Default secret for local development (should be overridden in production)
-		secret = "your-super-secure-jwt-secret-change-in-production"
-	}
-	jwtSecret = []byte(secret)
-}
-
 // Claims represents JWT token claims
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	WorkspaceID string   `json:"workspace_id"`
+	Role        string   `json:"role"`
+	Scopes      []string `json:"scopes"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for the user
-func GenerateToken(userID, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// AccessTokenTTL returns how long access tokens are valid, from ACCESS_TOKEN_TTL
+func AccessTokenTTL() time.Duration {
+	ttl := 15 * time.Minute
+	if ttlStr := os.Getenv("ACCESS_TOKEN_TTL"); ttlStr != "" {
+		if d, err := time.ParseDuration(ttlStr); err == nil && d > 0 {
+			ttl = d
+		}
+	}
+	return ttl
+}
+
+// GenerateToken creates a new short-lived JWT token for the user, scoped to one of
+// their workspaces, carrying the user's role and scopes. The session ID is stored as
+// the jti claim so the token can be revoked.
+func GenerateToken(userID, email, workspaceID, sessionID, role string, scopes []string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL())
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:      userID,
+		Email:       email,
+		WorkspaceID: workspaceID,
+		Role:        role,
+		Scopes:      scopes,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	if activeKey == nil {
+		return "", fmt.Errorf("signing keys are not loaded")
+	}
+
+	token := jwt.NewWithClaims(activeKey.method, claims)
+	token.Header["kid"] = activeKey.kid
+	tokenString, err := token.SignedString(activeKey.private)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %v", err)
 	}
@@ -51,10 +65,15 @@ func GenerateToken(userID, email string) (string, error) {
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := signingKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtSecret, nil
+		return key.public, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// loginDelayFreeFailures is how many failures in a row are allowed before logins slow down
+const loginDelayFreeFailures = 2
+
+// LoginPolicy limits how many failed logins an account or client IP gets
+type LoginPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+}
+
+// LoginPolicyFromEnv reads LOGIN_MAX_FAILURES, LOGIN_MAX_FAILURES_PER_IP and LOGIN_LOCKOUT_DURATION
+func LoginPolicyFromEnv() LoginPolicy {
+	policy := LoginPolicy{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		LockoutDuration:    15 * time.Minute,
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+		policy.MaxAccountFailures = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES_PER_IP")); err == nil && n > 0 {
+		policy.MaxIPFailures = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && d > 0 {
+		policy.LockoutDuration = d
+	}
+	return policy
+}
+
+// Delay returns how long logins are refused after the given number of failures in a row:
+// nothing at first, then doubling from one second, and the full lockout once max is reached
+func (p LoginPolicy) Delay(failures, max int) time.Duration {
+	if failures >= max {
+		return p.LockoutDuration
+	}
+	if failures <= loginDelayFreeFailures {
+		return 0
+	}
+
+	delay := time.Second
+	for i := loginDelayFreeFailures + 1; i < failures && delay < p.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.LockoutDuration {
+		delay = p.LockoutDuration
+	}
+	return delay
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// NewLoggerFromEnv returns a structured logger writing to w, as JSON unless LOG_FORMAT is
+// text, at LOG_LEVEL: debug, info (default), warn or error
+func NewLoggerFromEnv(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		opts.Level = slog.LevelDebug
+	case "warn", "warning":
+		opts.Level = slog.LevelWarn
+	case "error":
+		opts.Level = slog.LevelError
+	}
+
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailVerificationRequired reports whether users must verify their email before logging in
+// with a password, from REQUIRE_EMAIL_VERIFICATION
+func EmailVerificationRequired() bool {
+	switch strings.ToLower(os.Getenv("REQUIRE_EMAIL_VERIFICATION")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// PublicURL returns the address users reach the API at, for links in emails, from APP_BASE_URL
+func PublicURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// Mailer sends plain-text emails to users
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailerFromEnv picks the mail sender from MAIL_SENDER: smtp, file or log. Emails carry
+// login links, so the file and log senders, which leave them readable on the server, only
+// work in development mode. Unset, it is smtp when SMTP_HOST is set, log in development
+// and an error otherwise.
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	sender := strings.ToLower(os.Getenv("MAIL_SENDER"))
+	if sender == "" {
+		switch {
+		case os.Getenv("SMTP_HOST") != "":
+			sender = "smtp"
+		case DevelopmentMode():
+			sender = "log"
+		default:
+			return nil, fmt.Errorf("mail is not configured; set MAIL_SENDER=smtp and SMTP_HOST, or APP_ENV=development")
+		}
+	}
+	if (sender == "log" || sender == "file") && !DevelopmentMode() {
+		return nil, fmt.Errorf("MAIL_SENDER=%s writes login links where they can be read, so it needs APP_ENV=development", sender)
+	}
+
+	switch sender {
+	case "log":
+		return LogMailer{}, nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("MAIL_FILE is required with MAIL_SENDER=file")
+		}
+		return &FileMailer{Path: path}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required with MAIL_SENDER=smtp")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Addr:     host + ":" + port,
+			Host:     host,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_SENDER %q; use smtp, file or log", os.Getenv("MAIL_SENDER"))
+}
+
+// SMTPMailer sends mail through an SMTP server, using STARTTLS when the server offers it
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers one message
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.From, to, subject, time.Now().Format(time.RFC1123Z), body)
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %v", to, err)
+	}
+	return nil
+}
+
+// FileMailer appends every message to a file, so tests and local setups can read them back
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Send appends one message to the file
+func (m *FileMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "To: %s\nSubject: %s\n\n%s\n---\n", to, subject, body)
+	return err
+}
+
+// LogMailer writes messages to the server log instead of sending them, for development
+type LogMailer struct{}
+
+// Send logs one message
+func (LogMailer) Send(to, subject, body string) error {
+	slog.Info("mail", "to", to, "subject", subject, "body", body)
+	return nil
+}
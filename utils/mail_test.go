@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestNewMailerFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{env: map[string]string{}, wantErr: true},
+		{env: map[string]string{"MAIL_SENDER": "log"}, wantErr: true},
+		{env: map[string]string{"MAIL_SENDER": "file", "MAIL_FILE": "/tmp/mail.txt"}, wantErr: true},
+		{env: map[string]string{"MAIL_SENDER": "smtp"}, wantErr: true},
+		{env: map[string]string{"SMTP_HOST": "smtp.example.com"}, want: "smtp"},
+		{env: map[string]string{"APP_ENV": "development"}, want: "log"},
+		{env: map[string]string{"APP_ENV": "development", "MAIL_SENDER": "file", "MAIL_FILE": "/tmp/mail.txt"}, want: "file"},
+		{env: map[string]string{"APP_ENV": "development", "SMTP_HOST": "localhost"}, want: "smtp"},
+	} {
+		for _, name := range []string{"APP_ENV", "MAIL_SENDER", "MAIL_FILE", "SMTP_HOST"} {
+			t.Setenv(name, tc.env[name])
+		}
+
+		mailer, err := NewMailerFromEnv()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %T", tc.env, mailer)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.env, err)
+			continue
+		}
+
+		var got string
+		switch mailer.(type) {
+		case LogMailer:
+			got = "log"
+		case *FileMailer:
+			got = "file"
+		case *SMTPMailer:
+			got = "smtp"
+		}
+		if got != tc.want {
+			t.Errorf("%v: got %s mailer, want %s", tc.env, got, tc.want)
+		}
+	}
+}
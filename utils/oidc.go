@@ -0,0 +1,348 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcKeyRefreshInterval limits how often an unknown kid makes us refetch the provider's keys
+const oidcKeyRefreshInterval = time.Minute
+
+// OIDCProvider signs users in through an OpenID Connect identity provider using the
+// authorization-code flow with PKCE
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// oidcDiscovery holds the parts of the provider's discovery document we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the ID token claims used to find or provision the user
+type IDTokenClaims struct {
+	Nonce           string `json:"nonce"`
+	Email           string `json:"email"`
+	EmailVerified   *bool  `json:"email_verified"`
+	Name            string `json:"name"`
+	AuthorizedParty string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDCProviderFromEnv configures single sign-on from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and OIDC_SCOPES, returning nil when OIDC_ISSUER is unset.
+// The provider is only contacted on the first sign-in.
+func NewOIDCProviderFromEnv() *OIDCProvider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+
+	scopes := []string{"openid", "email", "profile"}
+	if scopesStr := os.Getenv("OIDC_SCOPES"); scopesStr != "" {
+		scopes = strings.Fields(scopesStr)
+	}
+
+	return &OIDCProvider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewPKCE returns a random code verifier and its S256 code challenge
+func NewPKCE() (string, string, error) {
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %v", err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewOIDCState returns a random value for the state or nonce parameter
+func NewOIDCState() (string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %v", err)
+	}
+	return state, nil
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *OIDCProvider) getJSON(endpoint string, v interface{}) error {
+	resp, err := p.Client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover loads and caches the provider's discovery document
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc oidcDiscovery
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery document: %v", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %s, expected %s", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing endpoints")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthCodeURL returns the provider URL that starts a sign-in
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for the provider's ID token
+func (p *OIDCProvider) Exchange(code, codeVerifier string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest("POST", doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to read token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request rejected: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the ID token's signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(rawIDToken, nonce string) (*IDTokenClaims, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.verificationKey(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	// With several audiences the token must have been issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("invalid ID token: issued to %s", claims.AuthorizedParty)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid ID token: missing subject")
+	}
+
+	return claims, nil
+}
+
+// verificationKey returns the provider's public key with the kid, refetching the key
+// set when the provider may have rotated keys
+func (p *OIDCProvider) verificationKey(kid string) (interface{}, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if !ok && time.Since(p.keysFetchedAt) > oidcKeyRefreshInterval {
+		var set struct {
+			Keys []oidcJWK `json:"keys"`
+		}
+		if err := p.getJSON(doc.JWKSURI, &set); err != nil {
+			return nil, fmt.Errorf("failed to load provider keys: %v", err)
+		}
+
+		keys := make(map[string]interface{})
+		for _, jwk := range set.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			if public, err := jwk.publicKey(); err == nil {
+				keys[jwk.Kid] = public
+			}
+		}
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+		key, ok = p.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown provider key %q", kid)
+	}
+
+	return key, nil
+}
+
+// oidcJWK is a public key from the provider's key set
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA, P-256/P-384 or Ed25519 key
+func (k oidcJWK) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
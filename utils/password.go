@@ -0,0 +1,357 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswordsList is a short bundled list of the most common and most breached passwords,
+// most common first. It only covers development; production loads a real list on top.
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// passwordMaxBytes is the most bcrypt hashes; anything longer would be silently cut off
+const passwordMaxBytes = 72
+
+// commonPasswords maps each blocked password to its popularity rank, starting at 1
+var commonPasswords = map[string]int{}
+
+// longestCommonPassword bounds the substring lengths the strength estimate looks up
+var longestCommonPassword int
+
+func init() {
+	addCommonPasswords(strings.NewReader(commonPasswordsList))
+}
+
+// addCommonPasswords adds one password per line, ranked after the ones already loaded
+func addCommonPasswords(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" {
+			continue
+		}
+		if _, exists := commonPasswords[word]; !exists {
+			commonPasswords[word] = len(commonPasswords) + 1
+			if n := len(word); n > longestCommonPassword {
+				longestCommonPassword = n
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadPasswordBlocklist extends the bundled list with PASSWORD_BLOCKLIST_FILE, one password
+// per line, e.g. a larger list of breached passwords. The bundled list is too short to
+// stop guessing on its own, so only development mode runs without the file.
+func LoadPasswordBlocklist() error {
+	path := os.Getenv("PASSWORD_BLOCKLIST_FILE")
+	if path == "" {
+		if DevelopmentMode() {
+			return nil
+		}
+		return fmt.Errorf("PASSWORD_BLOCKLIST_FILE is not set; point it at a list of breached passwords, or set APP_ENV=development")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open password blocklist: %v", err)
+	}
+	defer f.Close()
+
+	if err := addCommonPasswords(f); err != nil {
+		return fmt.Errorf("failed to read password blocklist: %v", err)
+	}
+	return nil
+}
+
+// PasswordPolicy is what new passwords must satisfy
+type PasswordPolicy struct {
+	MinLength  int
+	MinClasses int
+	MinScore   int
+}
+
+// PasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_CLASSES and PASSWORD_MIN_SCORE
+func PasswordPolicyFromEnv() PasswordPolicy {
+	policy := PasswordPolicy{MinLength: 10, MinClasses: 2, MinScore: 3}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		policy.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_CLASSES")); err == nil && n >= 0 && n <= 4 {
+		policy.MinClasses = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_SCORE")); err == nil && n >= 0 && n <= 4 {
+		policy.MinScore = n
+	}
+	return policy
+}
+
+// ValidatePassword checks a new password against the password policy. userInputs are
+// things like the email that an attacker would try first, and make a password weaker.
+func ValidatePassword(password string, userInputs ...string) error {
+	policy := PasswordPolicyFromEnv()
+
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+
+	if len(password) > passwordMaxBytes {
+		return fmt.Errorf("password must be at most %d bytes long", passwordMaxBytes)
+	}
+
+	if characterClasses(password) < policy.MinClasses {
+		return fmt.Errorf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", policy.MinClasses)
+	}
+
+	if IsCommonPassword(password) {
+		return fmt.Errorf("password is too common; it appears in lists of breached passwords")
+	}
+
+	if PasswordStrength(password, userInputs...) < policy.MinScore {
+		return fmt.Errorf("password is too easy to guess; make it longer or less predictable")
+	}
+
+	return nil
+}
+
+// characterClasses counts which of lowercase letters, uppercase letters, digits and symbols appear
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// unleet undoes the usual letter substitutions, so p@ssw0rd reads as password
+var unleet = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// IsCommonPassword reports whether the password, or the password without its substitutions
+// or the digits and symbols tacked on its end, is on the blocklist
+func IsCommonPassword(password string) bool {
+	lower := strings.ToLower(password)
+	trimmed := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	for _, candidate := range []string{lower, unleet.Replace(lower), trimmed, unleet.Replace(trimmed)} {
+		if _, ok := commonPasswords[candidate]; ok && candidate != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// keyboardSequences are runs of keys attackers try in order
+var keyboardSequences = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "abcdefghijklmnopqrstuvwxyz"}
+
+// PasswordStrength scores a password from 0 (trivial) to 4 (strong) like zxcvbn: it splits
+// the password into common words, user inputs, sequences, repeats and random characters,
+// estimates the guesses each part takes, and maps the total to a score
+func PasswordStrength(password string, userInputs ...string) int {
+	log10Guesses := estimateGuesses(password, userInputs)
+	switch {
+	case log10Guesses < 3:
+		return 0
+	case log10Guesses < 6:
+		return 1
+	case log10Guesses < 8:
+		return 2
+	case log10Guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// estimateGuesses returns log10 of roughly how many guesses finding the password takes
+func estimateGuesses(password string, userInputs []string) float64 {
+	runes := []rune(strings.ToLower(password))
+	plain := []rune(unleet.Replace(string(runes)))
+	if len(plain) != len(runes) {
+		plain = runes
+	}
+	original := []rune(password)
+
+	// Parts of the email and other user details are the first words an attacker tries
+	inputs := map[string]bool{}
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(part) >= 3 {
+				inputs[part] = true
+			}
+		}
+	}
+
+	total := 0.0
+	parts := 0
+	for i := 0; i < len(runes); {
+		length, guesses := bestMatch(runes, plain, i, inputs)
+		if length == 0 {
+			// Nothing predictable starts here, so this character has to be brute-forced
+			length, guesses = 1, math.Log10(float64(characterPool(string(runes[i]))))
+		} else if len(original) == len(runes) && hasUpper(original[i:i+length]) {
+			guesses += math.Log10(2)
+		}
+		total += guesses
+		parts++
+		i += length
+	}
+
+	// Attackers also have to find the right way to combine the parts
+	return total + math.Log10(float64(parts))
+}
+
+// bestMatch finds the longest predictable part starting at i and log10 of its guesses,
+// or a length of 0 if there is none
+func bestMatch(runes, plain []rune, i int, inputs map[string]bool) (int, float64) {
+	bestLength, bestGuesses := 0, 0.0
+	consider := func(length int, guesses float64) {
+		if length > bestLength || (length == bestLength && guesses < bestGuesses) {
+			bestLength, bestGuesses = length, guesses
+		}
+	}
+
+	// Common passwords and user inputs, also with substitutions undone
+	maxLength := len(runes) - i
+	if longestCommonPassword < maxLength {
+		maxLength = longestCommonPassword
+	}
+	for length := maxLength; length >= 4 && length >= bestLength; length-- {
+		for _, word := range []string{string(runes[i : i+length]), string(plain[i : i+length])} {
+			if rank, ok := commonPasswords[word]; ok {
+				consider(length, math.Log10(float64(rank)+1))
+			}
+		}
+	}
+	for input := range inputs {
+		length := utf8.RuneCountInString(input)
+		if i+length <= len(runes) && (string(runes[i:i+length]) == input || string(plain[i:i+length]) == input) {
+			consider(length, math.Log10(2))
+		}
+	}
+
+	// Repeated characters, like aaaa or 1111
+	repeat := 1
+	for i+repeat < len(runes) && runes[i+repeat] == runes[i] {
+		repeat++
+	}
+	if repeat >= 3 {
+		consider(repeat, math.Log10(float64(characterPool(string(runes[i]))*repeat)))
+	}
+
+	// Years, which people like to add to words
+	if i+4 <= len(runes) {
+		if year, err := strconv.Atoi(string(runes[i : i+4])); err == nil && year >= 1900 && year <= 2099 {
+			consider(4, math.Log10(200))
+		}
+	}
+
+	// Keyboard rows, the alphabet and digits, forwards or backwards
+	for _, seq := range keyboardSequences {
+		for _, s := range []string{seq, reverse(seq)} {
+			length := sequenceLength(s, runes[i:])
+			if length >= 3 {
+				base := 26
+				if unicode.IsDigit(runes[i]) {
+					base = 10
+				}
+				consider(length, math.Log10(float64(base*length)))
+			}
+		}
+	}
+
+	return bestLength, bestGuesses
+}
+
+// sequenceLength returns how many of runes follow seq from wherever the first rune appears in it
+func sequenceLength(seq string, runes []rune) int {
+	start := strings.IndexRune(seq, runes[0])
+	if start < 0 {
+		return 0
+	}
+	seqRunes := []rune(seq[start:])
+	length := 0
+	for length < len(runes) && length < len(seqRunes) && runes[length] == seqRunes[length] {
+		length++
+	}
+	return length
+}
+
+// characterPool returns how many different characters an attacker has to try per position
+func characterPool(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if pool == 0 {
+		pool = 1
+	}
+	return pool
+}
+
+// hasUpper reports whether any of the runes is an uppercase letter
+func hasUpper(runes []rune) bool {
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverse returns s backwards
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
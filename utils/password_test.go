@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPasswordBlocklist(t *testing.T) {
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", "")
+	t.Setenv("APP_ENV", "")
+	if err := LoadPasswordBlocklist(); err == nil {
+		t.Fatal("expected production to refuse running without a blocklist")
+	}
+
+	t.Setenv("APP_ENV", "development")
+	if err := LoadPasswordBlocklist(); err != nil {
+		t.Fatalf("development should run with the bundled list: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("Tr0ub4dor&3xyz\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", path)
+	t.Setenv("APP_ENV", "")
+	if err := LoadPasswordBlocklist(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsCommonPassword("tr0ub4dor&3xyz") {
+		t.Fatal("expected passwords from the file to be blocked")
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Quota scopes: whose tables a quota adds up
+const (
+	QuotaScopeUser      = "user"
+	QuotaScopeWorkspace = "workspace"
+)
+
+// Quota limits the tables, rows and bytes stored per user or per workspace. A zero
+// limit means no limit.
+type Quota struct {
+	Scope     string
+	MaxTables int64
+	MaxRows   int64
+	MaxBytes  int64
+}
+
+// QuotaFromEnv reads QUOTA_SCOPE, QUOTA_MAX_TABLES, QUOTA_MAX_ROWS and QUOTA_MAX_BYTES
+func QuotaFromEnv() Quota {
+	quota := Quota{Scope: QuotaScopeUser}
+	if strings.ToLower(os.Getenv("QUOTA_SCOPE")) == QuotaScopeWorkspace {
+		quota.Scope = QuotaScopeWorkspace
+	}
+	if n, err := strconv.ParseInt(os.Getenv("QUOTA_MAX_TABLES"), 10, 64); err == nil && n > 0 {
+		quota.MaxTables = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("QUOTA_MAX_ROWS"), 10, 64); err == nil && n > 0 {
+		quota.MaxRows = n
+	}
+	if n, err := ParseByteSize(os.Getenv("QUOTA_MAX_BYTES")); err == nil && n > 0 {
+		quota.MaxBytes = n
+	}
+	return quota
+}
+
+// Enabled reports whether any limit is set
+func (q Quota) Enabled() bool {
+	return q.MaxTables > 0 || q.MaxRows > 0 || q.MaxBytes > 0
+}
+
+// byteUnits are the suffixes ParseByteSize accepts, in powers of 1024
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size like 500MB, 10GB or a plain number of bytes
+func ParseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
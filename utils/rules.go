@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"etl-api/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReportedViolations caps the row errors kept in a validation report
+const maxReportedViolations = 100
+
+// RuleCheckResult holds the report and per-row violations of a rules check
+type RuleCheckResult struct {
+	Report     *models.ValidationReport
+	Violations map[int][]models.RowViolation
+	Rejected   bool
+}
+
+// NormalizeRules validates a rule set and sanitizes the column names it refers to
+func NormalizeRules(rules *models.ValidationRules) error {
+	if rules.OnFailure == "" {
+		rules.OnFailure = "reject"
+	}
+	if rules.OnFailure != "reject" && rules.OnFailure != "quarantine" {
+		return fmt.Errorf("on_failure must be 'reject' or 'quarantine'")
+	}
+
+	for i, name := range rules.RequiredColumns {
+		rules.RequiredColumns[i] = SanitizeColumnName(name)
+	}
+
+	columns := make(map[string]models.ColumnRule, len(rules.Columns))
+	for name, rule := range rules.Columns {
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern for column %s", name)
+			}
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("min is greater than max for column %s", name)
+		}
+		columns[SanitizeColumnName(name)] = rule
+	}
+	rules.Columns = columns
+
+	for i, rule := range rules.CrossColumn {
+		switch rule.Operator {
+		case "=", "!=", "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("invalid cross-column operator %q", rule.Operator)
+		}
+		rules.CrossColumn[i].Left = SanitizeColumnName(rule.Left)
+		rules.CrossColumn[i].Right = SanitizeColumnName(rule.Right)
+	}
+
+	if rules.MinRows != nil && rules.MaxRows != nil && *rules.MinRows > *rules.MaxRows {
+		return fmt.Errorf("min_rows is greater than max_rows")
+	}
+
+	return nil
+}
+
+// CheckRules validates CSV data against a rule set. existing holds values already
+// stored in the table for columns that must be unique.
+func CheckRules(data *CSVData, rules *models.ValidationRules, existing map[string]map[string]bool) *RuleCheckResult {
+	report := &models.ValidationReport{
+		TotalRows:   len(data.Rows),
+		TableErrors: []string{},
+		RowErrors:   []models.RowViolation{},
+		CheckedAt:   time.Now().UTC(),
+	}
+	result := &RuleCheckResult{
+		Report:     report,
+		Violations: make(map[int][]models.RowViolation),
+	}
+
+	index := make(map[string]int, len(data.Headers))
+	for i, col := range data.Headers {
+		index[col.Name] = i
+	}
+
+	// Table-level checks always reject the whole file
+	for _, name := range rules.RequiredColumns {
+		if _, ok := index[name]; !ok {
+			report.TableErrors = append(report.TableErrors, fmt.Sprintf("required column %s is missing", name))
+		}
+	}
+	if rules.MinRows != nil && len(data.Rows) < *rules.MinRows {
+		report.TableErrors = append(report.TableErrors, fmt.Sprintf("file has %d rows, minimum is %d", len(data.Rows), *rules.MinRows))
+	}
+	if rules.MaxRows != nil && len(data.Rows) > *rules.MaxRows {
+		report.TableErrors = append(report.TableErrors, fmt.Sprintf("file has %d rows, maximum is %d", len(data.Rows), *rules.MaxRows))
+	}
+
+	patterns := make(map[string]*regexp.Regexp)
+	seen := make(map[string]map[string]bool)
+	for name, rule := range rules.Columns {
+		if rule.Pattern != "" {
+			patterns[name] = regexp.MustCompile(rule.Pattern)
+		}
+		if rule.Unique {
+			seen[name] = make(map[string]bool)
+			for value := range existing[name] {
+				seen[name][value] = true
+			}
+		}
+	}
+
+	for rowIdx, row := range data.Rows {
+		value := func(name string) (string, bool) {
+			i, ok := index[name]
+			if !ok || i >= len(row) {
+				return "", ok
+			}
+			return strings.TrimSpace(row[i]), true
+		}
+		addViolation := func(column, rule, message string) {
+			result.Violations[rowIdx] = append(result.Violations[rowIdx], models.RowViolation{
+				Row:     rowIdx + 2, // header is line 1
+				Column:  column,
+				Rule:    rule,
+				Message: message,
+			})
+		}
+
+		for name, rule := range rules.Columns {
+			v, present := value(name)
+			if !present {
+				continue
+			}
+			if v == "" {
+				if rule.NotNull {
+					addViolation(name, "not_null", "value is required")
+				}
+				continue
+			}
+			if re := patterns[name]; re != nil && !re.MatchString(v) {
+				addViolation(name, "pattern", fmt.Sprintf("value %q does not match pattern", v))
+			}
+			if rule.Min != nil || rule.Max != nil {
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					addViolation(name, "range", fmt.Sprintf("value %q is not numeric", v))
+				} else if rule.Min != nil && n < *rule.Min {
+					addViolation(name, "range", fmt.Sprintf("value %v is below minimum %v", n, *rule.Min))
+				} else if rule.Max != nil && n > *rule.Max {
+					addViolation(name, "range", fmt.Sprintf("value %v is above maximum %v", n, *rule.Max))
+				}
+			}
+			if len(rule.Allowed) > 0 && !containsString(rule.Allowed, v) {
+				addViolation(name, "allowed", fmt.Sprintf("value %q is not an allowed value", v))
+			}
+			if rule.Unique {
+				if seen[name][v] {
+					addViolation(name, "unique", fmt.Sprintf("value %q is not unique", v))
+				}
+				seen[name][v] = true
+			}
+		}
+
+		for _, rule := range rules.CrossColumn {
+			left, leftOK := value(rule.Left)
+			right, rightOK := value(rule.Right)
+			if !leftOK || !rightOK || left == "" || right == "" {
+				continue
+			}
+			if !compareValues(left, right, rule.Operator) {
+				addViolation(rule.Left, "cross_column",
+					fmt.Sprintf("%s %s %s failed (%q vs %q)", rule.Left, rule.Operator, rule.Right, left, right))
+			}
+		}
+	}
+
+	report.InvalidRows = len(result.Violations)
+	report.ValidRows = report.TotalRows - report.InvalidRows
+
+	for rowIdx := 0; rowIdx < len(data.Rows); rowIdx++ {
+		for _, violation := range result.Violations[rowIdx] {
+			if len(report.RowErrors) >= maxReportedViolations {
+				report.Truncated = true
+				break
+			}
+			report.RowErrors = append(report.RowErrors, violation)
+		}
+	}
+
+	switch {
+	case len(report.TableErrors) > 0:
+		result.Rejected = true
+		report.Action = "rejected"
+	case report.InvalidRows == 0:
+		report.Action = "accepted"
+	case rules.OnFailure == "quarantine":
+		report.Action = "quarantined"
+	default:
+		result.Rejected = true
+		report.Action = "rejected"
+	}
+
+	return result
+}
+
+// compareValues compares two values as numbers, dates or strings, in that order
+func compareValues(left, right, operator string) bool {
+	cmp := 0
+	l, lErr := strconv.ParseFloat(left, 64)
+	r, rErr := strconv.ParseFloat(right, 64)
+	if lErr == nil && rErr == nil {
+		cmp = compareOrdered(l, r)
+	} else if lt, ok := parseDate(left); ok {
+		if rt, ok := parseDate(right); ok {
+			cmp = lt.Compare(rt)
+		} else {
+			cmp = strings.Compare(left, right)
+		}
+	} else {
+		cmp = strings.Compare(left, right)
+	}
+
+	switch operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameRuleColumn updates every reference to a column after it is renamed.
+// An empty newName removes the references instead.
+func RenameRuleColumn(rules *models.ValidationRules, oldName, newName string) {
+	var required []string
+	for _, name := range rules.RequiredColumns {
+		if name != oldName {
+			required = append(required, name)
+		} else if newName != "" {
+			required = append(required, newName)
+		}
+	}
+	rules.RequiredColumns = required
+
+	if rule, ok := rules.Columns[oldName]; ok {
+		delete(rules.Columns, oldName)
+		if newName != "" {
+			rules.Columns[newName] = rule
+		}
+	}
+
+	var crossColumn []models.CrossColumnRule
+	for _, rule := range rules.CrossColumn {
+		if rule.Left == oldName || rule.Right == oldName {
+			if newName == "" {
+				continue
+			}
+			if rule.Left == oldName {
+				rule.Left = newName
+			}
+			if rule.Right == oldName {
+				rule.Right = newName
+			}
+		}
+		crossColumn = append(crossColumn, rule)
+	}
+	rules.CrossColumn = crossColumn
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"etl-api/models"
+	"fmt"
+	"strings"
+)
+
+// SchemaPlan describes how to fit a file into an existing table
+type SchemaPlan struct {
+	AddColumns   []CSVColumn
+	WidenColumns []CSVColumn
+	Changes      []models.SchemaChange
+	Data         *CSVData
+}
+
+// DefaultSchemaPolicy adds new columns and fills missing ones with NULL
+func DefaultSchemaPolicy() models.SchemaPolicy {
+	return models.SchemaPolicy{
+		NewColumns:     "add",
+		MissingColumns: "null",
+	}
+}
+
+// NormalizeSchemaPolicy fills in defaults and validates a schema policy
+func NormalizeSchemaPolicy(policy *models.SchemaPolicy) error {
+	defaults := DefaultSchemaPolicy()
+	if policy.NewColumns == "" {
+		policy.NewColumns = defaults.NewColumns
+	}
+	if policy.MissingColumns == "" {
+		policy.MissingColumns = defaults.MissingColumns
+	}
+
+	switch policy.NewColumns {
+	case "add", "ignore", "reject":
+	default:
+		return fmt.Errorf("new_columns must be 'add', 'ignore' or 'reject'")
+	}
+
+	switch policy.MissingColumns {
+	case "null", "reject":
+	default:
+		return fmt.Errorf("missing_columns must be 'null' or 'reject'")
+	}
+
+	return nil
+}
+
+// WidenType returns the narrowest type that can hold both the current and
+// incoming column types, following INTEGER -> NUMERIC -> TEXT
+func WidenType(current, incoming string) string {
+	current = strings.ToUpper(current)
+	incoming = strings.ToUpper(incoming)
+
+	switch {
+	case current == incoming:
+		return current
+	case current == "TEXT":
+		return "TEXT"
+	case current == "NUMERIC" && incoming == "INTEGER":
+		return "NUMERIC"
+	case current == "INTEGER" && incoming == "NUMERIC":
+		return "NUMERIC"
+	default:
+		return "TEXT"
+	}
+}
+
+// PlanSchemaEvolution compares a file against the current column types of a
+// table and works out which columns to add, widen or drop from the load
+func PlanSchemaEvolution(current map[string]string, data *CSVData, policy models.SchemaPolicy) (*SchemaPlan, error) {
+	plan := &SchemaPlan{}
+
+	var keep []int
+	present := make(map[string]bool, len(data.Headers))
+	for i, col := range data.Headers {
+		present[col.Name] = true
+
+		currentType, exists := current[col.Name]
+		if !exists {
+			switch policy.NewColumns {
+			case "reject":
+				return nil, fmt.Errorf("file adds column %s, which this table does not accept", col.Name)
+			case "ignore":
+				continue
+			}
+			plan.AddColumns = append(plan.AddColumns, col)
+			plan.Changes = append(plan.Changes, models.SchemaChange{
+				Action: "add_column",
+				Column: col.Name,
+				To:     col.DataType,
+			})
+			keep = append(keep, i)
+			continue
+		}
+
+		keep = append(keep, i)
+
+		// Columns without any values don't carry type information
+		if !columnHasValues(data.Rows, i) {
+			continue
+		}
+
+		if widened := WidenType(currentType, col.DataType); widened != strings.ToUpper(currentType) {
+			plan.WidenColumns = append(plan.WidenColumns, CSVColumn{Name: col.Name, DataType: widened, Sample: col.Sample})
+			plan.Changes = append(plan.Changes, models.SchemaChange{
+				Action: "widen_type",
+				Column: col.Name,
+				From:   currentType,
+				To:     widened,
+			})
+		}
+	}
+
+	for name := range current {
+		if !present[name] && policy.MissingColumns == "reject" {
+			return nil, fmt.Errorf("file is missing column %s", name)
+		}
+	}
+
+	plan.Data = selectColumns(data, keep)
+	return plan, nil
+}
+
+// columnHasValues reports whether any row has a non-empty value in the column
+func columnHasValues(rows [][]string, columnIndex int) bool {
+	for _, row := range rows {
+		if columnIndex < len(row) && strings.TrimSpace(row[columnIndex]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectColumns returns a copy of data restricted to the given column indices
+func selectColumns(data *CSVData, keep []int) *CSVData {
+	if len(keep) == len(data.Headers) {
+		return data
+	}
+
+	selected := &CSVData{
+		Headers: make([]CSVColumn, len(keep)),
+		Rows:    make([][]string, len(data.Rows)),
+	}
+	for j, i := range keep {
+		selected.Headers[j] = data.Headers[i]
+	}
+	for r, row := range data.Rows {
+		values := make([]string, len(keep))
+		for j, i := range keep {
+			if i < len(row) {
+				values[j] = row[i]
+			}
+		}
+		selected.Rows[r] = values
+	}
+
+	return selected
+}
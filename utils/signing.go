@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"etl-api/models"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a key tokens are signed or verified with, identified by the kid header.
+// Keys retired from signing may be configured with only their public half.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+var (
+	signingKeys = map[string]*signingKey{}
+	activeKey   *signingKey
+)
+
+// DevelopmentMode reports whether the server runs in development, from APP_ENV
+func DevelopmentMode() bool {
+	env := strings.ToLower(os.Getenv("APP_ENV"))
+	return env == "development" || env == "dev"
+}
+
+// LoadSigningKeys reads the token signing keys: every <kid>.pem file in JWT_KEYS_DIR,
+// and JWT_PRIVATE_KEY with its kid in JWT_KEY_ID. JWT_ACTIVE_KID picks the key new
+// tokens are signed with; the others only verify tokens they signed earlier, so they
+// may be public keys.
+// Without any key, development mode signs with a throwaway key and any other mode fails.
+func LoadSigningKeys() error {
+	keys := map[string]*signingKey{}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %v", dir, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", file, err)
+			}
+			kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+			key, err := parseSigningKey(kid, data)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			keys[kid] = key
+		}
+	}
+
+	if pemData := os.Getenv("JWT_PRIVATE_KEY"); pemData != "" {
+		kid := os.Getenv("JWT_KEY_ID")
+		if kid == "" {
+			kid = "default"
+		}
+		if _, exists := keys[kid]; exists {
+			return fmt.Errorf("key id %s is configured twice", kid)
+		}
+		key, err := parseSigningKey(kid, []byte(pemData))
+		if err != nil {
+			return fmt.Errorf("JWT_PRIVATE_KEY: %v", err)
+		}
+		keys[kid] = key
+	}
+
+	if len(keys) == 0 {
+		if !DevelopmentMode() {
+			return fmt.Errorf("no signing keys configured; set JWT_KEYS_DIR or JWT_PRIVATE_KEY, or APP_ENV=development")
+		}
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to generate development key: %v", err)
+		}
+		keys["dev"] = &signingKey{kid: "dev", method: jwt.SigningMethodEdDSA, public: private.Public(), private: private}
+	}
+
+	active := os.Getenv("JWT_ACTIVE_KID")
+	if active == "" {
+		if len(keys) > 1 {
+			return fmt.Errorf("JWT_ACTIVE_KID must be set when more than one signing key is configured")
+		}
+		for kid := range keys {
+			active = kid
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("JWT_ACTIVE_KID %s does not match any signing key", active)
+	}
+	if keys[active].private == nil {
+		return fmt.Errorf("key %s is a public key and can't be the active key", active)
+	}
+
+	signingKeys = keys
+	activeKey = keys[active]
+	return nil
+}
+
+// ActiveKeyID returns the kid new tokens are signed with
+func ActiveKeyID() string {
+	if activeKey == nil {
+		return ""
+	}
+	return activeKey.kid
+}
+
+// parseSigningKey reads an RSA or Ed25519 key in PEM format. A private key can sign and
+// verify; a public key (a PUBLIC KEY block) only verifies.
+func parseSigningKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %v", err)
+	}
+
+	key := &signingKey{kid: kid}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private = signer
+		key.public = signer.Public()
+	} else {
+		key.public = parsed
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use RSA or Ed25519", parsed)
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys that verify our tokens
+func JWKS() models.JWKSet {
+	kids := make([]string, 0, len(signingKeys))
+	for kid := range signingKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := models.JWKSet{Keys: []models.JWK{}}
+	for _, kid := range kids {
+		key := signingKeys[kid]
+		jwk := models.JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
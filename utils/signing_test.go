@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKeyPair writes an Ed25519 key pair to dir as <kid>.pem, private or public only
+func writeKeyPair(t *testing.T, dir, kid string, publicOnly bool) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	if publicOnly {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(public)
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(private)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSigningKeysWithRetiredPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyPair(t, dir, "old", true)
+	writeKeyPair(t, dir, "new", false)
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_PRIVATE_KEY", "")
+	t.Setenv("APP_ENV", "")
+
+	t.Setenv("JWT_ACTIVE_KID", "old")
+	if err := LoadSigningKeys(); err == nil {
+		t.Fatal("expected a public key to be refused as the active key")
+	}
+
+	t.Setenv("JWT_ACTIVE_KID", "new")
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if jwks := JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "new" || jwks.Keys[1].Kid != "old" || jwks.Keys[1].X == "" {
+		t.Fatalf("expected both keys in the JWKS, got %+v", jwks.Keys)
+	}
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SourceFile represents a file fetched from a pipeline source
+type SourceFile struct {
+	Name    string
+	Content []byte
+	Hash    string
+}
+
+// HashContent returns the hex-encoded SHA-256 hash of file content
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveSourceDirectory resolves dir against the configured source root
+// and rejects paths that escape it
+func ResolveSourceDirectory(dir string) (string, error) {
+	root := os.Getenv("PIPELINE_SOURCE_ROOT")
+	if root == "" {
+		return "", fmt.Errorf("directory sources are disabled (PIPELINE_SOURCE_ROOT is not set)")
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid source root: %v", err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+dir)))
+	if err != nil {
+		return "", fmt.Errorf("source directory not found")
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source directory is outside the source root")
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("source is not a directory")
+	}
+
+	return resolved, nil
+}
+
+// ReadDirectorySource reads all files in dir matching pattern, sorted by name
+func ReadDirectorySource(dir, pattern string, maxSize int64) ([]SourceFile, error) {
+	resolved, err := ResolveSourceDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source directory: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, entry.Name()); matched {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var files []SourceFile
+	for _, name := range names {
+		content, err := readLimited(filepath.Join(resolved, name), maxSize)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, SourceFile{
+			Name:    name,
+			Content: content,
+			Hash:    HashContent(content),
+		})
+	}
+
+	return files, nil
+}
+
+// readLimited reads a file, refusing anything larger than maxSize
+func readLimited(filename string, maxSize int64) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", filepath.Base(filename), err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", filepath.Base(filename), err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("%s exceeds maximum file size", filepath.Base(filename))
+	}
+
+	return content, nil
+}
+
+// allowedSourceHost reports whether PIPELINE_ALLOWED_HOSTS lists the host, with or without its port
+func allowedSourceHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	for _, allowed := range strings.Split(os.Getenv("PIPELINE_ALLOWED_HOSTS"), ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed != "" && (strings.EqualFold(allowed, hostport) || strings.EqualFold(allowed, host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSourceURL checks that an HTTP source URL is allowed
+func ValidateSourceURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid source URL")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("source URL must use http or https")
+	}
+
+	// Optional allowlist of hosts, e.g. "data.example.com,localhost:9000"
+	if os.Getenv("PIPELINE_ALLOWED_HOSTS") != "" && !allowedSourceHost(u.Host) {
+		return nil, fmt.Errorf("source host is not in the allowed hosts list")
+	}
+
+	return u, nil
+}
+
+// internalAddress reports whether ip is on this machine or a private network: loopback,
+// link-local (which includes cloud metadata services), RFC 1918 and unique local addresses
+func internalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// refuseInternalAddress is a net.Dialer Control that refuses to connect to internal
+// addresses. It runs after DNS resolution, so a public name pointing inside is caught too.
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || internalAddress(ip) {
+		return fmt.Errorf("source address %s is on an internal network", host)
+	}
+	return nil
+}
+
+// sourceHTTPClient fetches HTTP sources. Only hosts listed in PIPELINE_ALLOWED_HOSTS may be
+// on internal networks, and redirects are checked like the URL the pipeline names.
+func sourceHTTPClient() *http.Client {
+	public := &net.Dialer{Timeout: 30 * time.Second, Control: refuseInternalAddress}
+	listed := &net.Dialer{Timeout: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if allowedSourceHost(address) {
+			return listed.DialContext(ctx, network, address)
+		}
+		return public.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("source redirected too many times")
+			}
+			if _, err := ValidateSourceURL(req.URL.String()); err != nil {
+				return fmt.Errorf("source redirected to a disallowed URL: %v", err)
+			}
+			return nil
+		},
+	}
+}
+
+// FetchHTTPSource downloads a single file from an HTTP(S) source
+func FetchHTTPSource(rawURL string, maxSize int64) (*SourceFile, error) {
+	u, err := ValidateSourceURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sourceHTTPClient().Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch source: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source returned HTTP %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %v", err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("source exceeds maximum file size")
+	}
+
+	name := path.Base(u.Path)
+	if name == "" || name == "/" || name == "." {
+		name = u.Hostname() + ".csv"
+	}
+
+	return &SourceFile{
+		Name:    name,
+		Content: content,
+		Hash:    HashContent(content),
+	}, nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// csvServer serves a small CSV file at /export.csv and redirects /moved to target
+func csvServer(t *testing.T, target string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/export.csv", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id,name\n1,Ada\n"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchHTTPSourceFromAllowedLocalServer(t *testing.T) {
+	server := csvServer(t, "")
+	t.Setenv("PIPELINE_ALLOWED_HOSTS", strings.TrimPrefix(server.URL, "http://"))
+
+	file, err := FetchHTTPSource(server.URL+"/export.csv", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "export.csv" || string(file.Content) != "id,name\n1,Ada\n" || file.Hash != HashContent(file.Content) {
+		t.Fatalf("unexpected file %q with content %q", file.Name, file.Content)
+	}
+
+	if _, err := FetchHTTPSource(server.URL+"/export.csv", 4); err == nil {
+		t.Fatal("expected a file over the size limit to be refused")
+	}
+}
+
+func TestFetchHTTPSourceRefusesInternalAddresses(t *testing.T) {
+	server := csvServer(t, "")
+	t.Setenv("PIPELINE_ALLOWED_HOSTS", "")
+
+	for _, rawURL := range []string{
+		server.URL + "/export.csv",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/export.csv",
+		"http://[::1]/export.csv",
+	} {
+		if _, err := FetchHTTPSource(rawURL, 1024); err == nil || !strings.Contains(err.Error(), "internal network") {
+			t.Errorf("fetching %s: got %v, want an internal network error", rawURL, err)
+		}
+	}
+}
+
+func TestFetchHTTPSourceChecksRedirects(t *testing.T) {
+	internal := csvServer(t, "")
+	for _, target := range []string{internal.URL + "/export.csv", "http://169.254.169.254/latest/meta-data/"} {
+		server := csvServer(t, target)
+		t.Setenv("PIPELINE_ALLOWED_HOSTS", strings.TrimPrefix(server.URL, "http://"))
+
+		if _, err := FetchHTTPSource(server.URL+"/moved", 1024); err == nil || !strings.Contains(err.Error(), "disallowed URL") {
+			t.Errorf("redirect to %s: got %v, want it refused", target, err)
+		}
+	}
+}
+
+func TestValidateSourceURL(t *testing.T) {
+	t.Setenv("PIPELINE_ALLOWED_HOSTS", "data.example.com, localhost:9000")
+
+	for rawURL, ok := range map[string]bool{
+		"https://data.example.com/export.csv":  true,
+		"https://DATA.example.com:8443/a.csv":  true,
+		"http://localhost:9000/a.csv":          true,
+		"http://localhost:9001/a.csv":          false,
+		"https://other.example.com/export.csv": false,
+		"ftp://data.example.com/export.csv":    false,
+		"/export.csv":                          false,
+	} {
+		if _, err := ValidateSourceURL(rawURL); (err == nil) != ok {
+			t.Errorf("ValidateSourceURL(%q) = %v, want allowed %v", rawURL, err, ok)
+		}
+	}
+}
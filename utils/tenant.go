@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TenantSchemasEnabled reports whether each workspace gets its own Postgres schema, from TENANT_SCHEMAS
+func TenantSchemasEnabled() bool {
+	switch strings.ToLower(os.Getenv("TENANT_SCHEMAS")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// TenantSchemaName returns the Postgres schema holding a workspace's tables
+func TenantSchemaName(workspaceID string) string {
+	return "tenant_" + strings.ReplaceAll(workspaceID, "-", "")
+}
+
+// TableLocation returns the schema and table name a new table is created under.
+// The schema is empty when tables live in the public schema.
+func TableLocation(workspaceID, tableName string) (string, string) {
+	if TenantSchemasEnabled() {
+		name := sanitizeIdentifier(tableName)
+		if name == "" {
+			name = "table"
+		}
+		return TenantSchemaName(workspaceID), limitIdentifier("", name)
+	}
+	return "", SanitizeTableName(workspaceID, tableName)
+}
+
+// QuoteTableName returns the quoted, schema-qualified reference to a table for use in SQL
+func QuoteTableName(schema, table string) string {
+	if schema == "" {
+		return fmt.Sprintf(`"%s"`, table)
+	}
+	return fmt.Sprintf(`"%s"."%s"`, schema, table)
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RefreshTokenTTL returns how long a session can go without being refreshed, from REFRESH_TOKEN_TTL
+func RefreshTokenTTL() time.Duration {
+	ttl := 30 * 24 * time.Hour // 30 days default
+	if ttlStr := os.Getenv("REFRESH_TOKEN_TTL"); ttlStr != "" {
+		if d, err := time.ParseDuration(ttlStr); err == nil && d > 0 {
+			ttl = d
+		}
+	}
+	return ttl
+}
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognize
+const APIKeyPrefix = "etl_"
+
+// randomToken returns 32 random bytes encoded for use in headers and URLs
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateRefreshToken returns a new random opaque refresh token
+func GenerateRefreshToken() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	return token, nil
+}
+
+// GenerateEmailToken returns a new random token for an email verification or password reset link
+func GenerateEmailToken() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate email token: %v", err)
+	}
+	return token, nil
+}
+
+// GenerateMFAToken returns a new random token that finishes a login waiting for an MFA code
+func GenerateMFAToken() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate MFA token: %v", err)
+	}
+	return token, nil
+}
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return APIKeyPrefix + token, nil
+}
+
+// HashToken returns the SHA-256 hex digest under which an opaque token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
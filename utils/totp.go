@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps
+	totpIssuer = "ETL API"
+	// totpPeriod is how long each code is valid
+	totpPeriod = 30 * time.Second
+	// totpDigits is the length of each code
+	totpDigits = 6
+	// totpSkew is how many periods before and after now are accepted, for clock drift
+	totpSkew = 1
+)
+
+// recoveryCodeAlphabet is Crockford's base32, which leaves out characters that are easy to confuse
+const recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// GenerateTOTPSecret returns a new random base32 secret for an authenticator app (RFC 6238)
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI authenticator apps import, usually shown as a QR code
+func TOTPProvisioningURI(secret, accountName string) string {
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpCode computes the code for one time step
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// ValidateTOTP checks a code against the secret at time t. It returns the time step the
+// code belongs to, so callers can refuse a code that was already used.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := t.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n single-use codes formatted like xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery codes: %v", err)
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[b[j]&31]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode puts a recovery code in the form it is hashed in, so codes typed
+// without the dash or in upper case still match
+func NormalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -20,19 +20,6 @@ func ValidateEmail(email string) error {
 	return nil
 }
 
-// ValidatePassword checks if password meets requirements
-func ValidatePassword(password string) error {
-	if password == "" {
-		return fmt.Errorf("password is required")
-	}
-
-	if len(password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters long")
-	}
-
-	return nil
-}
-
 // ValidateTableName checks if table name is valid
 func ValidateTableName(name string) error {
 	name = strings.TrimSpace(name)
@@ -47,8 +34,14 @@ func ValidateTableName(name string) error {
 	return nil
 }
 
-// SanitizeTableName creates a safe PostgreSQL table name
-func SanitizeTableName(userID, tableName string) string {
+// SanitizeTableName creates a safe PostgreSQL table name namespaced by workspace
+func SanitizeTableName(workspaceID, tableName string) string {
+	// Add workspace prefix to avoid conflicts
+	return limitIdentifier(fmt.Sprintf("ws_%s_", strings.ReplaceAll(workspaceID, "-", "")), sanitizeIdentifier(tableName))
+}
+
+// sanitizeIdentifier turns a display name into a lowercase PostgreSQL identifier
+func sanitizeIdentifier(tableName string) string {
 	// Remove non-alphanumeric characters and spaces
 	reg := regexp.MustCompile(`[^a-zA-Z0-9]+`)
 	sanitized := reg.ReplaceAllString(tableName, "_")
@@ -63,7 +56,24 @@ func SanitizeTableName(userID, tableName string) string {
 	if len(sanitized) > 0 && sanitized[0] >= '0' && sanitized[0] <= '9' {
 		sanitized = "table_" + sanitized
 	}
-	
-	// Add user prefix to avoid conflicts
-	return fmt.Sprintf("user_%s_%s", userID[:8], sanitized)
-}
\ No newline at end of file
+
+	return sanitized
+}
+
+// limitIdentifier joins a prefix and a name within PostgreSQL's 63 byte identifier limit
+func limitIdentifier(prefix, name string) string {
+	if len(prefix)+len(name) > 63 {
+		name = strings.TrimRight(name[:63-len(prefix)], "_")
+	}
+	return prefix + name
+}
+
+// SnapshotTableName returns the physical name of a frozen table version
+func SnapshotTableName(tableID string, version int) string {
+	return fmt.Sprintf("snap_%s_v%d", strings.ReplaceAll(tableID, "-", ""), version)
+}
+
+// TrashTableName returns the physical name a deleted table is kept under
+func TrashTableName(tableID string) string {
+	return fmt.Sprintf("trash_%s", strings.ReplaceAll(tableID, "-", ""))
+}